@@ -0,0 +1,486 @@
+package main
+
+import (
+	"context"       // Recognizes a run stopped by a signal or the deadline
+	"encoding/json" // Prints the statistics as JSON
+	"errors"        // Recognizes the help request of a flag set
+	"flag"          // Parses command-line flags
+	"fmt"           // Formats the usage text and the command output
+	"io"            // Provides basic I/O primitives
+	"log"           // Implements logging functionality
+	"net/http"      // Serves the API
+	"net/url"       // Checks the target URLs
+	"os"            // Provides platform-independent OS functions, including file handling
+	"sort"          // Implements sorting functions
+	"strings"       // Provides string manipulation utilities
+	"time"          // Provides functionality for measuring and displaying time
+
+	"github.com/complexorganizations/proxy-registry/registry" // Runs the scrape, validate and publish pipeline
+	"github.com/complexorganizations/proxy-registry/source"   // Reads the proxy lists
+	"github.com/complexorganizations/proxy-registry/store"    // Reads and converts the listings
+	"github.com/complexorganizations/proxy-registry/validate" // Serves the judge
+)
+
+// A subcommand of the program, such as "update" or "check".
+type command struct {
+	name        string                                 // Name typed on the command line
+	arguments   string                                 // Positional arguments shown in the usage, if any
+	description string                                 // One line explaining what the command does
+	run         func(cmd command, args []string) error // Parses the command flags and runs it
+}
+
+// Every command the program understands, in the order they are listed in the usage.
+var commands = []command{
+	{name: "update", description: "Scrape the sources, validate every proxy and update the listings and the history.", run: runUpdateCommand},
+	{name: "scrape", description: "Fetch the sources and print the proxies they list, without validating them.", run: runScrapeCommand},
+	{name: "validate", description: "Validate the proxies of an existing list and print the working ones.", run: runValidateCommand},
+	{name: "check", arguments: "<proxy>", description: "Test a single proxy with every protocol and report each stage: connect, handshake, CONNECT, TLS, status and headers.", run: runCheckCommand},
+	{name: "export", description: "Convert a structured listing to text, JSON, NDJSON or CSV.", run: runExportCommand},
+	{name: "serve", description: "Serve the listings and a small JSON API over HTTP.", run: runServeCommand},
+	{name: "stats", description: "Summarize the published listing and the proxy history.", run: runStatsCommand},
+	{name: "judge", description: "Serve the anonymity judge and a known-content validation target over HTTP and HTTPS.", run: runJudgeCommand},
+}
+
+// Write the list of commands to the writer.
+func printUsage(writer io.Writer) {
+	fmt.Fprintln(writer, "Usage: proxy-registry <command> [flags] [arguments]")
+	fmt.Fprintln(writer)
+	fmt.Fprintln(writer, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(writer, "  %-9s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintln(writer)
+	fmt.Fprintln(writer, `Run "proxy-registry <command> -help" for the flags of a command.`)
+	fmt.Fprintln(writer, "The -update flag of earlier versions still works and runs the update command.")
+}
+
+// Run the named command with the remaining arguments.
+func runCommand(name string, args []string) error {
+	// Asking for help is not an error.
+	if isHelpArgument(name) {
+		printUsage(os.Stdout)
+		return nil
+	}
+	// Find the command and run it.
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		err := cmd.run(cmd, args)
+		// The flag set already printed the usage when help was asked for.
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	// Nothing matched.
+	printUsage(os.Stderr)
+	return fmt.Errorf("unknown command %q", name)
+}
+
+// Create the flag set of the command, with a usage text that explains it.
+func (cmd command) newFlagSet() *flag.FlagSet {
+	flagSet := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: proxy-registry %s [flags] %s\n\n%s\n\nFlags:\n", cmd.name, cmd.arguments, cmd.description)
+		flagSet.PrintDefaults()
+	}
+	return flagSet
+}
+
+// Register the flag that points at the sources file.
+func addSourceFlags(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&sourcesFile, "sources", sourcesFile, "Path to the JSON file listing the proxy sources.")
+}
+
+// Register the flags that bound how the sources are downloaded.
+func addFetchFlags(flagSet *flag.FlagSet) {
+	flagSet.IntVar(&fetchConcurrency, "fetch-concurrency", fetchConcurrency, "Number of sources fetched at the same time.")
+	flagSet.DurationVar(&fetchTimeout, "fetch-timeout", fetchTimeout, "Time one source request may take, body included, e.g. 1m. Zero means no limit.")
+	flagSet.IntVar(&fetchRetries, "fetch-retries", fetchRetries, "Requests repeated, with a doubling wait, after a network error or a 5xx answer from a source.")
+	flagSet.Int64Var(&fetchMaxSize, "fetch-max-size", fetchMaxSize, "Largest source body in bytes; a larger one fails the source. Zero means no limit.")
+	flagSet.StringVar(&sourceCacheDir, "source-cache", sourceCacheDir, "Directory the source bodies are kept in, so unchanged sources are not downloaded again. Empty disables the cache.")
+}
+
+// Register the flag that sizes the history of the sources report.
+func addSourceReportFlags(flagSet *flag.FlagSet) {
+	flagSet.IntVar(&sourceReportRuns, "source-report-runs", sourceReportRuns, "Number of runs kept in the sources report. Zero keeps every run.")
+}
+
+// Register the flag that sizes the validation pool.
+func addWorkerFlags(flagSet *flag.FlagSet) {
+	flagSet.IntVar(&workerCount, "workers", workerCount, "Number of proxies to validate concurrently.")
+}
+
+// Register the flags that change how a single proxy is validated.
+func addValidationFlags(flagSet *flag.FlagSet) {
+	flagSet.DurationVar(&maxLatency, "max-latency", maxLatency, "Reject proxies whose average request time is above this, e.g. 5s. Zero disables the limit.")
+	flagSet.StringVar(&throughputURL, "throughput-url", throughputURL, "URL of a small file downloaded through every working proxy to measure throughput.")
+	flagSet.StringVar(&judgeURL, "judge", judgeURL, "URL of a judge server used to classify proxy anonymity, e.g. http://judge.example.com:8080/.")
+	flagSet.StringVar(&targetList, "targets", targetList, "Comma separated URLs requested through every proxy. A {nonce} in a URL is replaced with a random value the response must echo, e.g. http://judge.example.com:8080/target?nonce={nonce}, and a #sha256=<hex> fragment gives the hash the response body must have.")
+	flagSet.StringVar(&targetCAFile, "target-ca", targetCAFile, "PEM file of certificate authorities trusted for HTTPS targets besides the system ones, e.g. the one that signed the judge certificate.")
+}
+
+// Split the comma separated target list into its URLs, skipping empty entries.
+func splitTargetList(list string) []string {
+	var targets []string
+	for _, target := range strings.Split(list, ",") {
+		if target = strings.TrimSpace(target); target != "" {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// Register the flags of the history retention rules and the tamper threshold.
+func addHistoryFlags(flagSet *flag.FlagSet) {
+	flagSet.IntVar(&historyRetentionDays, "history-retention", historyRetentionDays, "Drop history entries that have not passed validation for this many days. Zero keeps them forever.")
+	flagSet.IntVar(&historyMaxFailures, "history-max-failures", historyMaxFailures, "Drop history entries that failed validation this many runs in a row. Zero disables the rule.")
+	flagSet.Float64Var(&tamperThreshold, "tamper-threshold", tamperThreshold, "Stop validating proxies whose tamper score in the history reaches this, until the history retention drops them. Zero disables the rule.")
+}
+
+// Register the flag that bounds how long a run may take.
+func addDeadlineFlag(flagSet *flag.FlagSet) {
+	flagSet.DurationVar(&deadline, "deadline", deadline, "Stop after this long, e.g. 45m, and publish the proxies validated so far. Zero lets the run finish.")
+}
+
+// Register the flags that decide which addresses are dialed: the DNS server used for the proxies listed by hostname,
+// and whether private and other reserved addresses are validated.
+func addAddressFlags(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&resolverAddress, "resolver", resolverAddress, "DNS server used to resolve proxies listed by hostname, e.g. 1.1.1.1:53. Empty uses the system resolver.")
+	flagSet.BoolVar(&allowPrivate, "allow-private", allowPrivate, "Validate proxies on private, loopback, documentation and other reserved addresses, e.g. in a lab.")
+}
+
+// Check the flag values that cannot be expressed by their types.
+func checkFlagValues() error {
+	// A pool without workers would never validate anything.
+	if workerCount < 1 {
+		return errors.New("-workers must be at least 1")
+	}
+	// Negative retention rules make no sense.
+	if historyRetentionDays < 0 || historyMaxFailures < 0 {
+		return errors.New("-history-retention and -history-max-failures cannot be negative")
+	}
+	if tamperThreshold < 0 {
+		return errors.New("-tamper-threshold cannot be negative")
+	}
+	if sourceReportRuns < 0 {
+		return errors.New("-source-report-runs cannot be negative")
+	}
+	// Fetching needs at least one worker, and negative limits make no sense.
+	if fetchConcurrency < 1 {
+		return errors.New("-fetch-concurrency must be at least 1")
+	}
+	if fetchTimeout < 0 || fetchRetries < 0 || fetchMaxSize < 0 {
+		return errors.New("-fetch-timeout, -fetch-retries and -fetch-max-size cannot be negative")
+	}
+	// A deadline in the past would stop the run before it starts.
+	if deadline < 0 {
+		return errors.New("-deadline cannot be negative")
+	}
+	// Every target must be a URL the validators can request.
+	for _, target := range splitTargetList(targetList) {
+		parsed, err := url.Parse(target)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("-targets: %q is not an absolute http or https URL", target)
+		}
+		if err := validate.CheckTargetFragment(target); err != nil {
+			return fmt.Errorf("-targets: %w", err)
+		}
+	}
+	// A resolver that cannot be dialed would drop every hostname.
+	if _, err := source.NewResolver(resolverAddress); err != nil {
+		return fmt.Errorf("-resolver: %w", err)
+	}
+	return nil
+}
+
+// Parse the flags of the command and reject any positional argument it does not take.
+func parseCommandFlags(flagSet *flag.FlagSet, args []string, positional int) error {
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if flagSet.NArg() != positional {
+		flagSet.Usage()
+		return fmt.Errorf("%s takes %d argument(s), got %d", flagSet.Name(), positional, flagSet.NArg())
+	}
+	return checkFlagValues()
+}
+
+// Scrape the sources, validate every proxy and update the listings.
+func runUpdate() error {
+	// Stop early on SIGINT, SIGTERM or the deadline.
+	ctx, cancel := newRunContext()
+	defer cancel()
+	// Load the configuration before any network activity.
+	pipeline, err := newRegistry()
+	if err != nil {
+		return err
+	}
+	// Learn our own public address from the judge so leaks can be recognized.
+	if pipeline.Checker, err = newChecker(ctx); err != nil {
+		return err
+	}
+	// Scrape the proxy lists and update the listings.
+	return runOutcome(pipeline.Run(ctx))
+}
+
+// Translate the error of a run that was stopped early.
+// Reaching the deadline is the planned end of the run, while a signal is reported as an interruption.
+func runOutcome(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Println("Stopped at the deadline of", deadline)
+		return nil
+	}
+	if errors.Is(err, context.Canceled) {
+		return errors.New("interrupted")
+	}
+	return err
+}
+
+// The update command: the whole scrape, validate and publish workflow.
+func runUpdateCommand(cmd command, args []string) error {
+	flagSet := cmd.newFlagSet()
+	addSourceFlags(flagSet)
+	addFetchFlags(flagSet)
+	addSourceReportFlags(flagSet)
+	addWorkerFlags(flagSet)
+	addValidationFlags(flagSet)
+	addHistoryFlags(flagSet)
+	addDeadlineFlag(flagSet)
+	addAddressFlags(flagSet)
+	if err := parseCommandFlags(flagSet, args, 0); err != nil {
+		return err
+	}
+	return runUpdate()
+}
+
+// The scrape command: fetch the sources and print the proxies, with the protocol hint of their source when there is one.
+func runScrapeCommand(cmd command, args []string) error {
+	flagSet := cmd.newFlagSet()
+	addSourceFlags(flagSet)
+	addFetchFlags(flagSet)
+	addAddressFlags(flagSet)
+	output := flagSet.String("output", "-", `File to write the proxies to, "-" for standard output.`)
+	if err := parseCommandFlags(flagSet, args, 0); err != nil {
+		return err
+	}
+	// Load the configuration and fetch every source.
+	pipeline, err := newRegistry()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := newRunContext()
+	defer cancel()
+	proxies, _ := pipeline.Scrape(ctx)
+	if err := ctx.Err(); err != nil {
+		return runOutcome(err)
+	}
+	source.LogFilterReport(pipeline.Inclusions, pipeline.Exclusions)
+	// Write one proxy per line, prefixed with its hinted scheme.
+	var lines []string
+	for _, proxy := range proxies {
+		lines = append(lines, proxy.String())
+	}
+	sort.Strings(lines)
+	return writeCommandOutput(*output, []byte(joinLines(lines)))
+}
+
+// The validate command: re-check the proxies of an existing list.
+func runValidateCommand(cmd command, args []string) error {
+	flagSet := cmd.newFlagSet()
+	addWorkerFlags(flagSet)
+	addValidationFlags(flagSet)
+	addHistoryFlags(flagSet)
+	addDeadlineFlag(flagSet)
+	addAddressFlags(flagSet)
+	input := flagSet.String("input", hostsFile, "List of proxies to validate, one host:port or scheme://host:port per line.")
+	output := flagSet.String("output", "-", `File to write the working proxies to, "-" for standard output.`)
+	write := flagSet.Bool("write", false, "Replace the listings and record the run in the history instead of printing the working proxies.")
+	if err := parseCommandFlags(flagSet, args, 0); err != nil {
+		return err
+	}
+	// A missing list is a mistake, not an empty run.
+	if _, err := os.Stat(*input); err != nil {
+		return err
+	}
+	// Read the proxies, remembering the scheme of each line as its protocol hint.
+	seen := make(map[string]bool)
+	var proxies []source.Proxy
+	rejected := 0
+	for _, line := range source.ReadList(*input) {
+		proxy, err := source.ParseProxy(line)
+		if err != nil {
+			rejected++
+			continue
+		}
+		if seen[proxy.Address] {
+			continue
+		}
+		seen[proxy.Address] = true
+		proxy.Sources = []string{*input}
+		proxies = append(proxies, proxy)
+	}
+	if rejected > 0 {
+		log.Printf("Skipped %d lines of %s that hold no proxy", rejected, *input)
+	}
+	// Stop early on SIGINT, SIGTERM or the deadline.
+	ctx, cancel := newRunContext()
+	defer cancel()
+	// Learn our own public address from the judge so leaks can be recognized.
+	checker, err := newChecker(ctx)
+	if err != nil {
+		return err
+	}
+	// Resolve the hostnames, then validate the proxies with the worker pool.
+	resolver, err := source.NewResolver(resolverAddress)
+	if err != nil {
+		return err
+	}
+	pipeline := &registry.Registry{Checker: checker, Store: newStore(), Workers: workerCount, Resolver: resolver, AllowPrivate: allowPrivate, TamperThreshold: tamperThreshold}
+	results, checked := pipeline.Validate(ctx, pipeline.Prepare(ctx, proxies))
+	clean, tampering := validate.SplitTampering(results)
+	log.Printf("%d of %d proxies passed validation, %d were caught tampering with the traffic", len(clean), len(checked), len(tampering))
+	// Either publish the results or print them, even when the run was stopped early.
+	if *write {
+		if len(checked) > 0 {
+			pipeline.Store.WriteListings(results, checked)
+		}
+		return runOutcome(ctx.Err())
+	}
+	content, err := store.EncodeListing("text", clean)
+	if err != nil {
+		return err
+	}
+	if err := writeCommandOutput(*output, content); err != nil {
+		return err
+	}
+	return runOutcome(ctx.Err())
+}
+
+// The check command: test one proxy and print what happened.
+func runCheckCommand(cmd command, args []string) error {
+	flagSet := cmd.newFlagSet()
+	addValidationFlags(flagSet)
+	if err := parseCommandFlags(flagSet, args, 1); err != nil {
+		return err
+	}
+	// Stop the report on SIGINT or SIGTERM.
+	ctx, cancel := newRunContext()
+	defer cancel()
+	// Learn our own public address from the judge so leaks can be recognized.
+	checker, err := newChecker(ctx)
+	if err != nil {
+		return err
+	}
+	proxy, err := source.ParseProxy(flagSet.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid proxy %q: %w", source.RedactCredentials(flagSet.Arg(0)), err)
+	}
+	return runOutcome(checker.Report(ctx, os.Stdout, proxy))
+}
+
+// The export command: convert a structured listing to another format.
+func runExportCommand(cmd command, args []string) error {
+	flagSet := cmd.newFlagSet()
+	input := flagSet.String("input", hostsJSONFile, "Listing to convert, a hosts.json or hosts.ndjson file.")
+	format := flagSet.String("format", "json", "Format to write: "+strings.Join(store.ExportFormats, ", ")+".")
+	output := flagSet.String("output", "-", `File to write the listing to, "-" for standard output.`)
+	if err := parseCommandFlags(flagSet, args, 0); err != nil {
+		return err
+	}
+	// Read the listing and convert it.
+	results, err := store.ReadListing(*input)
+	if err != nil {
+		return err
+	}
+	content, err := store.EncodeListing(*format, results)
+	if err != nil {
+		return err
+	}
+	return writeCommandOutput(*output, content)
+}
+
+// The serve command: run the API until the process is stopped.
+func runServeCommand(cmd command, args []string) error {
+	flagSet := cmd.newFlagSet()
+	address := flagSet.String("listen", ":8080", "Address to listen on.")
+	if err := parseCommandFlags(flagSet, args, 0); err != nil {
+		return err
+	}
+	// Create the server with timeouts so slow clients cannot hold connections forever.
+	server := &http.Server{
+		Addr:              *address,
+		Handler:           registry.NewAPIHandler(newStore()),
+		ReadHeaderTimeout: time.Second * 10,
+		ReadTimeout:       time.Second * 30,
+		WriteTimeout:      time.Second * 30,
+	}
+	log.Println("API server listening on", *address)
+	return server.ListenAndServe()
+}
+
+// The judge command: serve the judge over HTTP and HTTPS until the process is stopped.
+func runJudgeCommand(cmd command, args []string) error {
+	flagSet := cmd.newFlagSet()
+	address := flagSet.String("listen", ":8080", "Address to serve plain HTTP on.")
+	tlsAddress := flagSet.String("tls-listen", ":8443", `Address to serve HTTPS on, "" to serve plain HTTP only.`)
+	certFile := flagSet.String("tls-cert", "", "Certificate file for HTTPS. Without one a self-signed certificate is generated.")
+	keyFile := flagSet.String("tls-key", "", "Private key file of -tls-cert.")
+	tlsHosts := flagSet.String("tls-host", "", "Comma separated names and addresses the generated certificate is valid for, e.g. judge.example.com. Empty uses the host of -tls-listen, or the loopback names.")
+	certOut := flagSet.String("tls-cert-out", "judge-cert.pem", `File the generated certificate is written to as PEM, for -target-ca on the validating side; "" skips it.`)
+	if err := parseCommandFlags(flagSet, args, 0); err != nil {
+		return err
+	}
+	// A certificate is useless without its key and the other way round.
+	if (*certFile == "") != (*keyFile == "") {
+		return errors.New("-tls-cert and -tls-key must be given together")
+	}
+	// The names of the generated certificate, separated by commas or spaces.
+	hosts := strings.FieldsFunc(*tlsHosts, func(r rune) bool { return r == ',' || r == ' ' })
+	// Serve both until either fails.
+	failed := make(chan error, 2)
+	go func() { failed <- validate.ServeJudge(*address) }()
+	if *tlsAddress != "" {
+		go func() { failed <- validate.ServeJudgeTLS(*tlsAddress, *certFile, *keyFile, hosts, *certOut) }()
+	}
+	return <-failed
+}
+
+// The stats command: summarize the listing and the history.
+func runStatsCommand(cmd command, args []string) error {
+	flagSet := cmd.newFlagSet()
+	asJSON := flagSet.Bool("json", false, "Print the statistics as JSON.")
+	if err := parseCommandFlags(flagSet, args, 0); err != nil {
+		return err
+	}
+	stats, err := newStore().Stats()
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(stats)
+	}
+	stats.WriteText(os.Stdout)
+	return nil
+}
+
+// Join the lines with a newline after each one.
+func joinLines(lines []string) string {
+	var builder strings.Builder
+	for _, line := range lines {
+		builder.WriteString(line + "\n")
+	}
+	return builder.String()
+}
+
+// Write the command output to standard output when the path is "-", otherwise replace the file atomically.
+func writeCommandOutput(path string, content []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(content)
+		return err
+	}
+	return store.WriteFileAtomically(path, content)
+}
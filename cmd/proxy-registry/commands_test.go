@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/complexorganizations/proxy-registry/store"
+	"github.com/complexorganizations/proxy-registry/validate"
+)
+
+// Point every asset path at a fresh temporary directory for the duration of the test.
+func useTemporaryAssets(t *testing.T) string {
+	t.Helper()
+	directory := t.TempDir()
+	paths := []*string{&hostsFile, &historyFile, &historyStoreFile, &capabilitiesFile, &hostsJSONFile, &hostsNDJSONFile, &authHostsFile, &tamperingFile, &sourcesFile, &sourcesReportFile, &sourceCacheDir, &inclusionList, &exclusionList}
+	previous := make([]string, len(paths))
+	for index, path := range paths {
+		previous[index] = *path
+		*path = filepath.Join(directory, filepath.Base(*path))
+	}
+	t.Cleanup(func() {
+		for index, path := range paths {
+			*path = previous[index]
+		}
+	})
+	return directory
+}
+
+func TestRunCommandRejectsAnUnknownCommand(t *testing.T) {
+	if err := runCommand("frobnicate", nil); err == nil || !strings.Contains(err.Error(), "frobnicate") {
+		t.Fatalf("err = %v, want an unknown command error", err)
+	}
+}
+
+func TestRunCommandTreatsHelpAsSuccess(t *testing.T) {
+	if err := runCommand("export", []string{"-help"}); err != nil {
+		t.Fatalf("asking for help failed: %v", err)
+	}
+}
+
+func TestCommandsRejectUnexpectedArguments(t *testing.T) {
+	if err := runCommand("stats", []string{"extra"}); err == nil {
+		t.Fatal("expected an error for an unexpected argument")
+	}
+	if err := runCommand("check", nil); err == nil {
+		t.Fatal("expected an error for a missing proxy")
+	}
+}
+
+func TestCommandsRejectInvalidTargets(t *testing.T) {
+	t.Cleanup(func() { targetList = "" })
+	if err := runCommand("check", []string{"-targets", "http://judge.example.com/target,ftp://example.com/", "203.0.113.10:8080"}); err == nil || !strings.Contains(err.Error(), "ftp://") {
+		t.Fatalf("err = %v, want the ftp target rejected", err)
+	}
+	if err := runCommand("check", []string{"-targets", "https://example.com/robots.txt#sha256=abcd", "203.0.113.10:8080"}); err == nil || !strings.Contains(err.Error(), "sha256=abcd") {
+		t.Fatalf("err = %v, want the short hash rejected", err)
+	}
+	if err := runCommand("judge", []string{"-tls-cert", "judge.pem"}); err == nil {
+		t.Fatal("expected an error for a certificate without its key")
+	}
+}
+
+func TestScrapeCommandRejectsInvalidFetchLimits(t *testing.T) {
+	t.Cleanup(func() { fetchConcurrency, fetchRetries = 8, 3 })
+	if err := runCommand("scrape", []string{"-fetch-concurrency", "0"}); err == nil || !strings.Contains(err.Error(), "-fetch-concurrency") {
+		t.Fatalf("err = %v, want the fetcher without workers rejected", err)
+	}
+	fetchConcurrency = 8
+	if err := runCommand("scrape", []string{"-fetch-retries", "-1"}); err == nil || !strings.Contains(err.Error(), "-fetch-retries") {
+		t.Fatalf("err = %v, want the negative retries rejected", err)
+	}
+}
+
+func TestScrapeCommandWritesTheSourcesWithoutValidating(t *testing.T) {
+	directory := useTemporaryAssets(t)
+	feed := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		fmt.Fprintln(writer, "203.0.113.20:1080")
+		fmt.Fprintln(writer, "203.0.113.10:8080")
+		fmt.Fprintln(writer, "203.0.113.20:1080")
+	}))
+	defer feed.Close()
+	sources := fmt.Sprintf(`{"sources": [{"url": %q, "protocol": "socks5", "format": "text"}]}`, feed.URL)
+	if err := os.WriteFile(sourcesFile, []byte(sources), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(exclusionList, []byte("203.0.113.10\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(directory, "scraped")
+	// The documentation addresses of the feed are reserved, so they would be filtered without -allow-private.
+	t.Cleanup(func() { allowPrivate = false })
+
+	if err := runCommand("scrape", []string{"-allow-private", "-output", output}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "socks5://203.0.113.20:1080\n" {
+		t.Fatalf("scraped = %q", content)
+	}
+}
+
+func TestValidateCommandRequiresTheInputList(t *testing.T) {
+	directory := useTemporaryAssets(t)
+	if err := runCommand("validate", []string{"-input", filepath.Join(directory, "missing")}); err == nil {
+		t.Fatal("expected an error for a missing list")
+	}
+}
+
+func TestExportCommandConvertsBetweenFormats(t *testing.T) {
+	directory := useTemporaryAssets(t)
+	checkedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	content, err := store.EncodeListing("ndjson", []validate.Result{
+		{Proxy: "203.0.113.10:8080", Protocols: []validate.ProtocolResult{{Scheme: "socks5", URL: "socks5://203.0.113.10:8080", LatencyMS: 90}}, Anonymity: validate.AnonymityElite, FirstSeen: checkedAt, LastChecked: checkedAt},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(hostsNDJSONFile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	csvOutput := filepath.Join(directory, "hosts.csv")
+	if err := runCommand("export", []string{"-input", hostsNDJSONFile, "-format", "csv", "-output", csvOutput}); err != nil {
+		t.Fatal(err)
+	}
+	converted, err := os.ReadFile(csvOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(converted)), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[1], "203.0.113.10:8080,socks5,") {
+		t.Fatalf("csv = %q", converted)
+	}
+}
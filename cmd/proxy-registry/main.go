@@ -0,0 +1,251 @@
+// Command proxy-registry scrapes public proxy lists, validates every proxy and publishes the working ones.
+package main
+
+import (
+	"context"       // Cancels the run on a signal or at the deadline
+	"flag"          // Parses command-line flags
+	"log"           // Implements logging functionality
+	"os"            // Provides platform-independent OS functions, including file handling
+	"os/signal"     // Turns SIGINT and SIGTERM into a cancellation
+	"path/filepath" // Locates the source cache in the cache directory of the user
+	"strings"       // Provides string manipulation utilities
+	"syscall"       // Names the SIGTERM signal
+	"time"          // Provides functionality for measuring and displaying time
+
+	"github.com/complexorganizations/proxy-registry/registry" // Runs the scrape, validate and publish pipeline
+	"github.com/complexorganizations/proxy-registry/source"   // Loads the sources and the filter lists
+	"github.com/complexorganizations/proxy-registry/store"    // Writes the listings and the history
+	"github.com/complexorganizations/proxy-registry/validate" // Validates the proxies
+)
+
+var (
+	// File paths for various required asset files
+	inclusionList     = "assets/inclusion"           // Path to inclusion list file
+	exclusionList     = "assets/exclusion"           // Path to exclusion list file
+	hostsFile         = "assets/hosts"               // Path to hosts file
+	historyFile       = "assets/history"             // Path to history file
+	historyStoreFile  = "assets/history.json"        // Path to the history store with the uptime of every proxy
+	capabilitiesFile  = "assets/capabilities"        // Path to the HTTP proxy capabilities file
+	hostsJSONFile     = "assets/hosts.json"          // Path to the structured hosts listing
+	hostsNDJSONFile   = "assets/hosts.ndjson"        // Path to the newline delimited hosts listing
+	authHostsFile     = "assets/hosts-authenticated" // Path to the listing of the proxies that need credentials
+	tamperingFile     = "assets/hosts-tampering"     // Path to the listing of the proxies caught tampering with the traffic
+	sourcesFile       = "assets/sources.json"        // Path to the proxy sources file
+	sourcesReportFile = "assets/sources-report.json" // Path to the report of how every source did in the latest runs
+	// Flag variable of earlier versions to determine whether the listings should be updated
+	update bool
+	// Number of proxies validated at the same time
+	workerCount = 256
+	// URL of the judge used to classify anonymity; classification is skipped when empty
+	judgeURL string
+	// Comma separated URLs requested through every proxy; empty uses the default targets
+	targetList string
+	// PEM file of certificate authorities trusted for the targets besides the system ones
+	targetCAFile string
+	// Address the built-in judge server listens on; the server is only started when set
+	judgeListenAddress string
+	// Proxies whose average request time is above this are rejected; zero disables the limit
+	maxLatency time.Duration
+	// URL of a file downloaded through every proxy to measure throughput; empty disables the measurement
+	throughputURL string
+	// Entries that have not passed validation for this many days are pruned; zero keeps them forever
+	historyRetentionDays = 30
+	// Entries that failed this many runs in a row are pruned; zero disables the rule
+	historyMaxFailures int
+	// Number of sources fetched at the same time
+	fetchConcurrency = 8
+	// Time one source request may take, body included; zero means no limit
+	fetchTimeout = time.Second * 30
+	// Requests repeated after a network error or a 5xx answer from a source
+	fetchRetries = 3
+	// Largest source body read; a larger one fails the source; zero means no limit
+	fetchMaxSize int64 = 32 << 20
+	// Directory the source bodies are kept in for conditional requests; empty disables them
+	sourceCacheDir = defaultSourceCacheDir()
+	// Runs kept in the sources report; zero keeps every run
+	sourceReportRuns = 30
+	// Proxies whose tamper score in the history reaches this are not validated; zero disables the rule
+	tamperThreshold float64 = registry.DefaultTamperThreshold
+	// The run stops and publishes what it validated once this much time has passed; zero lets it finish
+	deadline time.Duration
+	// DNS server used to resolve the proxies listed by hostname; empty uses the system resolver
+	resolverAddress string
+	// Whether proxies on private, loopback and other reserved addresses are validated
+	allowPrivate bool
+)
+
+// Parse the flags of earlier versions, such as -update, into the global variables.
+func parseFlags() {
+	// Define a boolean flag "-update" to indicate updating the listings
+	flag.BoolVar(&update, "update", false, "Make any necessary changes to the listings. Same as the update command.")
+	// Define the flags shared with the commands
+	addSourceFlags(flag.CommandLine)
+	addFetchFlags(flag.CommandLine)
+	addSourceReportFlags(flag.CommandLine)
+	addWorkerFlags(flag.CommandLine)
+	addValidationFlags(flag.CommandLine)
+	addHistoryFlags(flag.CommandLine)
+	addDeadlineFlag(flag.CommandLine)
+	addAddressFlags(flag.CommandLine)
+	// Define a string flag "-judge-listen" to run the built-in judge server
+	flag.StringVar(&judgeListenAddress, "judge-listen", "", "Run the built-in judge server on the given address, e.g. :8080.")
+	// Parse command-line flags
+	flag.Parse()
+	// Stop on values that cannot work
+	if err := checkFlagValues(); err != nil {
+		log.Fatalln("Error:", err)
+	}
+}
+
+func main() {
+	// Without arguments there is nothing to do, so explain how to use the program
+	if len(os.Args) < 2 {
+		printUsage(os.Stderr)
+		os.Exit(2)
+	}
+	// Arguments starting with a dash are the flags of earlier versions, kept so existing scripts keep working
+	if strings.HasPrefix(os.Args[1], "-") && !isHelpArgument(os.Args[1]) {
+		parseFlags()
+		// If the "judge-listen" flag is set, run the judge server until the process is stopped
+		if judgeListenAddress != "" {
+			log.Fatalln(validate.ServeJudge(judgeListenAddress))
+		}
+		// If the "update" flag is set, scrape and update the lists
+		if update {
+			if err := runUpdate(); err != nil {
+				log.Fatalln("Error:", err)
+			}
+		}
+		return
+	}
+	// Otherwise the first argument names a command
+	if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+		log.Fatalln("Error:", err)
+	}
+}
+
+// Report whether the argument asks for the usage.
+func isHelpArgument(argument string) bool {
+	return argument == "help" || argument == "-help" || argument == "--help" || argument == "-h"
+}
+
+// Return the directory of the source cache in the cache directory of the user, or nothing when there is none.
+func defaultSourceCacheDir() string {
+	directory, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(directory, "proxy-registry", "sources")
+}
+
+// Create the fetcher of the sources with the limits named by the flags.
+func newFetcher() *source.Fetcher {
+	fetcher := source.NewFetcher()
+	fetcher.Concurrency = fetchConcurrency
+	fetcher.Timeout = fetchTimeout
+	fetcher.Retries = fetchRetries
+	fetcher.MaxSize = fetchMaxSize
+	fetcher.CacheDir = sourceCacheDir
+	return fetcher
+}
+
+// Create the store of the asset files named by the flags.
+func newStore() *store.Store {
+	return &store.Store{
+		HostsFile:              hostsFile,
+		HistoryFile:            historyFile,
+		HistoryStoreFile:       historyStoreFile,
+		CapabilitiesFile:       capabilitiesFile,
+		HostsJSONFile:          hostsJSONFile,
+		HostsNDJSONFile:        hostsNDJSONFile,
+		AuthenticatedHostsFile: authHostsFile,
+		TamperingHostsFile:     tamperingFile,
+		SourcesReportFile:      sourcesReportFile,
+		RetentionDays:          historyRetentionDays,
+		MaxFailures:            historyMaxFailures,
+		ReportRuns:             sourceReportRuns,
+	}
+}
+
+// Return a context that is cancelled by SIGINT or SIGTERM, or once the -deadline has passed.
+// After the first signal the default handling is restored, so a second one stops the process at once.
+func newRunContext() (context.Context, context.CancelFunc) {
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stopSignals()
+	}()
+	// Without a deadline only a signal ends the run early.
+	if deadline <= 0 {
+		return ctx, stopSignals
+	}
+	ctx, cancel := context.WithTimeout(ctx, deadline)
+	return ctx, func() {
+		cancel()
+		stopSignals()
+	}
+}
+
+// Create the checker configured by the flags, learning our own public address from the judge when one is set.
+func newChecker(ctx context.Context) (*validate.Checker, error) {
+	checker := validate.NewChecker()
+	checker.MaxLatency = maxLatency
+	checker.ThroughputURL = throughputURL
+	// Request our own targets, such as the built-in judge, instead of the default ones.
+	if targets := splitTargetList(targetList); len(targets) > 0 {
+		checker.Targets = targets
+	}
+	// Trust the authority of a judge whose certificate no public one signed.
+	if targetCAFile != "" {
+		roots, err := validate.LoadRootCAs(targetCAFile)
+		if err != nil {
+			return nil, err
+		}
+		checker.RootCAs = roots
+	}
+	// See the targets without a proxy, so redirects and certificates through a proxy can be compared.
+	// A target that fails without a proxy stops the run before any proxy is scored for it.
+	baseline, err := validate.LearnBaseline(ctx, checker.Targets, checker.RootCAs)
+	if err != nil {
+		return nil, err
+	}
+	checker.Baseline = baseline
+	// Without a judge every proxy is classified as unknown.
+	if judgeURL == "" {
+		return checker, nil
+	}
+	judge, err := validate.NewJudge(ctx, judgeURL)
+	if err != nil {
+		return nil, err
+	}
+	checker.Judge = judge
+	return checker, nil
+}
+
+// Load the sources and the inclusion and exclusion lists into a registry, stopping on any problem.
+func newRegistry() (*registry.Registry, error) {
+	// Load and validate the sources file before any network activity.
+	sources, err := source.LoadFile(sourcesFile)
+	if err != nil {
+		return nil, err
+	}
+	// Create the registry that writes to the asset files.
+	pipeline := registry.New(sources, newStore())
+	pipeline.Fetcher = newFetcher()
+	pipeline.Workers = workerCount
+	pipeline.AllowPrivate = allowPrivate
+	pipeline.TamperThreshold = tamperThreshold
+	// Resolve the hostnames with the configured DNS server.
+	if pipeline.Resolver, err = source.NewResolver(resolverAddress); err != nil {
+		return nil, err
+	}
+	// Load the proxies that must always be validated.
+	if pipeline.Inclusions, err = source.LoadInclusionRules(inclusionList); err != nil {
+		return nil, err
+	}
+	// Load the rules for proxies that must never be validated.
+	if pipeline.Exclusions, err = source.LoadExclusionRules(exclusionList); err != nil {
+		return nil, err
+	}
+	return pipeline, nil
+}
@@ -0,0 +1,47 @@
+// Package atomicfile replaces files so a reader or a cancelled run never sees half of one.
+package atomicfile
+
+import (
+	"os"            // Provides platform-independent OS functions, including file handling
+	"path/filepath" // Locates the directory of the file being replaced
+)
+
+// Replace the file at the given path with the content so readers see either the old or the new file, never a partial one.
+// The content goes to a temporary file in the same directory, is flushed to disk, and is then renamed over the original.
+func Write(path string, content []byte) error {
+	// Create the temporary file next to the destination so the rename stays on one file system.
+	directory := filepath.Dir(path)
+	temporaryFile, err := os.CreateTemp(directory, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	temporaryPath := temporaryFile.Name()
+	// Remove the temporary file if anything below fails; after the rename this is a no-op.
+	defer os.Remove(temporaryPath)
+	// Write the content and flush it to stable storage before it becomes visible.
+	if _, err := temporaryFile.Write(content); err != nil {
+		temporaryFile.Close()
+		return err
+	}
+	if err := temporaryFile.Sync(); err != nil {
+		temporaryFile.Close()
+		return err
+	}
+	if err := temporaryFile.Close(); err != nil {
+		return err
+	}
+	// Temporary files are created private, so give it the usual permissions of a published file.
+	if err := os.Chmod(temporaryPath, 0644); err != nil {
+		return err
+	}
+	// Swap the new file into place in a single step.
+	if err := os.Rename(temporaryPath, path); err != nil {
+		return err
+	}
+	// Flush the directory entry as well; not every platform allows syncing a directory, so errors are ignored.
+	if directoryHandle, err := os.Open(directory); err == nil {
+		_ = directoryHandle.Sync()
+		directoryHandle.Close()
+	}
+	return nil
+}
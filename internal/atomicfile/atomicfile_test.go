@@ -0,0 +1,39 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteReplacesTheFileWithTheUsualPermissions(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "hosts")
+	if err := os.WriteFile(path, []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(path, []byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "new\n" || info.Mode().Perm() != 0644 {
+		t.Fatalf("content = %q, mode = %v; want the new content readable by everyone", content, info.Mode().Perm())
+	}
+	if entries, err := os.ReadDir(directory); err != nil || len(entries) != 1 {
+		t.Fatalf("entries = %v, err = %v; want only the replaced file to remain", entries, err)
+	}
+}
+
+func TestWriteReportsAMissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing-directory", "hosts")
+	if err := Write(path, []byte("new\n")); err == nil {
+		t.Fatal("expected an error when the directory does not exist")
+	}
+}
@@ -0,0 +1,195 @@
+// Package registry ties the sources, the validation and the store together into the scrape, validate and publish pipeline.
+package registry
+
+import (
+	"context"     // Stops the pipeline when the run is cancelled
+	"log"         // Implements logging functionality
+	"net"         // Resolves the hostnames of the proxies
+	"sync"        // Implements synchronization primitives like WaitGroup and Mutex
+	"sync/atomic" // Provides atomic counters shared between goroutines
+
+	"github.com/complexorganizations/proxy-registry/source"   // Where the proxies come from
+	"github.com/complexorganizations/proxy-registry/store"    // Where the results go
+	"github.com/complexorganizations/proxy-registry/validate" // How the proxies are checked
+)
+
+// Tamper score at which a proxy is no longer validated; a self-signed certificate on a tunnel reaches it at once.
+const DefaultTamperThreshold = 100
+
+// Everything needed to run the pipeline once.
+type Registry struct {
+	Sources         []source.Source         // Lists of proxies to fetch
+	Fetcher         *source.Fetcher         // Downloads the lists; nil uses the default limits
+	Inclusions      []*source.InclusionRule // Proxies that are always validated
+	Exclusions      []*source.ExclusionRule // Proxies that are never validated
+	Checker         *validate.Checker       // Validates every proxy
+	Store           *store.Store            // Receives the listings and the history
+	Workers         int                     // Number of proxies validated at the same time
+	Resolver        *net.Resolver           // Looks up the proxies listed by hostname
+	AllowPrivate    bool                    // Validate proxies on private, loopback and other reserved addresses, which are dropped by default
+	TamperThreshold float64                 // Proxies whose tamper score in the history reaches this are not validated; zero disables the rule
+}
+
+// Create a registry that validates with the default checker and writes to the store.
+func New(sources []source.Source, listings *store.Store) *Registry {
+	return &Registry{
+		Sources:         sources,
+		Fetcher:         source.NewFetcher(),
+		Checker:         validate.NewChecker(),
+		Store:           listings,
+		Workers:         256,
+		Resolver:        net.DefaultResolver,
+		TamperThreshold: DefaultTamperThreshold,
+	}
+}
+
+// Fetch every enabled source, apply the inclusion and exclusion lists and resolve the hostnames.
+// Along with the proxies it returns how every source did.
+func (registry *Registry) Scrape(ctx context.Context) ([]source.Proxy, []source.SourceReport) {
+	proxies, reports := source.Collect(ctx, registry.Fetcher, registry.Sources, registry.Inclusions, registry.Exclusions, registry.AllowPrivate)
+	return registry.prepare(ctx, proxies, reports), reports
+}
+
+// Look up the proxies listed by hostname, drop the ones that resolve to a proxy already listed,
+// drop the proxies the history caught tampering too often, drop the hostnames that resolve to an excluded address,
+// and drop every proxy on a reserved address unless private addresses are allowed.
+func (registry *Registry) Prepare(ctx context.Context, proxies []source.Proxy) []source.Proxy {
+	return registry.prepare(ctx, proxies, nil)
+}
+
+// Prepare the proxies, adding the hostnames dropped for resolving to reserved addresses to the reports of their sources.
+func (registry *Registry) prepare(ctx context.Context, proxies []source.Proxy, reports []source.SourceReport) []source.Proxy {
+	// Fall back to the system resolver for registries built by hand.
+	resolver := registry.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	proxies = source.ResolveHostnames(ctx, resolver, proxies)
+	proxies = registry.dropTampering(proxies)
+	// An excluded address stays excluded when a hostname resolves to it.
+	proxies = source.DropExcludedAddresses(registry.Exclusions, proxies)
+	// Nothing may dial a reserved address, whether it was listed as one or a hostname resolved to it.
+	if registry.AllowPrivate {
+		return proxies
+	}
+	proxies, reserved := source.DropReservedBySource(proxies, reports)
+	if reserved > 0 {
+		log.Printf("Dropped %d proxies on reserved addresses", reserved)
+	}
+	return proxies
+}
+
+// Drop the proxies whose tamper score in the history reached the threshold.
+// The score only decays on runs that check the proxy, so a dropped proxy stays dropped until the history forgets it
+// after the retention period; with a retention of zero days the history never does, and the exclusion is permanent.
+func (registry *Registry) dropTampering(proxies []source.Proxy) []source.Proxy {
+	if registry.TamperThreshold <= 0 || registry.Store == nil {
+		return proxies
+	}
+	history, err := registry.Store.LoadHistory()
+	if err != nil {
+		log.Println("Error loading history:", err)
+		return proxies
+	}
+	kept := make([]source.Proxy, 0, len(proxies))
+	for _, proxy := range proxies {
+		if history.TamperScore(proxy.Address) < registry.TamperThreshold {
+			kept = append(kept, proxy)
+		}
+	}
+	if dropped := len(proxies) - len(kept); dropped > 0 {
+		log.Printf("Excluded %d proxies with a tamper score of %g or more", dropped, registry.TamperThreshold)
+	}
+	return kept
+}
+
+// Validate every proxy using a fixed-size pool of workers and return the ones that work,
+// along with the addresses of every proxy whose check ran to the end.
+// When the context is done no more proxies are queued, the checks in progress are abandoned
+// and whatever was validated until then is returned.
+func (registry *Registry) Validate(ctx context.Context, proxies []source.Proxy) ([]validate.Result, []string) {
+	// Collect the results of this call only.
+	output := newOutputSink()
+	// Never run with fewer than one worker.
+	workerCount := registry.Workers
+	if workerCount < 1 {
+		workerCount = 1
+	}
+	// Create a small queue so the producer blocks while every worker is busy.
+	queue := make(chan source.Proxy, workerCount)
+	// Count the finished proxies so progress can be reported.
+	var processed atomic.Int64
+	var waitGroup sync.WaitGroup
+	log.Printf("Validating %d proxies with %d workers", len(proxies), workerCount)
+	// Start the workers.
+	for i := 0; i < workerCount; i++ {
+		// Increment the wait group counter before launching a worker.
+		waitGroup.Add(1)
+		go registry.validationWorker(ctx, queue, output, &waitGroup, &processed, len(proxies))
+	}
+	// Queue every proxy, waiting for room whenever the queue is full, until the run is cancelled.
+queueing:
+	for _, proxy := range proxies {
+		select {
+		case queue <- proxy:
+		case <-ctx.Done():
+			break queueing
+		}
+	}
+	// Close the queue so the workers stop once it is drained.
+	close(queue)
+	// Wait for the workers to finish the remaining proxies.
+	waitGroup.Wait()
+	// Say how far a cancelled run got.
+	checked := output.checkedAddresses()
+	if err := ctx.Err(); err != nil {
+		log.Printf("Validation stopped after %d of %d proxies: %v", len(checked), len(proxies), err)
+	}
+	return output.snapshot(), checked
+}
+
+// Validate proxies from the queue until it is closed and empty.
+func (registry *Registry) validationWorker(ctx context.Context, queue <-chan source.Proxy, output *outputSink, waitGroup *sync.WaitGroup, processed *atomic.Int64, total int) {
+	// Signal that this worker is done processing (decrement the wait group counter)
+	defer waitGroup.Done()
+	// Take proxies from the queue one at a time.
+	for proxy := range queue {
+		// Drain the queue without checking anything once the run is cancelled.
+		if ctx.Err() != nil {
+			continue
+		}
+		// Validate the proxy and queue the result if at least one protocol works.
+		result, ok := registry.Checker.Check(ctx, proxy)
+		if ok {
+			output.add(result)
+		}
+		// A check cut short by the cancellation says nothing about the proxy, so it is not recorded as a failure.
+		if ok || ctx.Err() == nil {
+			output.markChecked(proxy.Address)
+		}
+		// Log the progress every thousand proxies.
+		if count := processed.Add(1); count%1000 == 0 {
+			log.Printf("Validated %d of %d proxies", count, total)
+		}
+	}
+}
+
+// Scrape the sources, validate every proxy and write the listings.
+// A run cancelled during validation still writes the proxies validated so far, and returns the context error.
+func (registry *Registry) Run(ctx context.Context) error {
+	// Fetch, filter and resolve the proxies of every source.
+	proxies, reports := registry.Scrape(ctx)
+	// Validate the cleaned proxy list with a fixed number of workers.
+	results, checked := registry.Validate(ctx, proxies)
+	// Keep the current listings when the run was cancelled before anything was checked.
+	if len(checked) == 0 && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// Report how every source did before the history learns the proxies of this run.
+	registry.Store.WriteSourcesReport(reports, results)
+	// Write every listing from the validation results.
+	registry.Store.WriteListings(results, checked)
+	// Report how many entries each inclusion and exclusion rule matched.
+	source.LogFilterReport(registry.Inclusions, registry.Exclusions)
+	return ctx.Err()
+}
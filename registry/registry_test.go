@@ -0,0 +1,189 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/complexorganizations/proxy-registry/source"
+	"github.com/complexorganizations/proxy-registry/store"
+	"github.com/complexorganizations/proxy-registry/validate"
+)
+
+// A validator that passes the proxies on even ports at once and holds the others until the context is done.
+type stubValidator struct {
+	started atomic.Int64
+}
+
+func (*stubValidator) Scheme() string {
+	return "http"
+}
+
+func (validator *stubValidator) Validate(ctx context.Context, address string, user *url.Userinfo, targets []string) (validate.ProtocolResult, error) {
+	validator.started.Add(1)
+	if _, port := source.SplitHostPort(address); port[len(port)-1]%2 == 0 {
+		return validate.ProtocolResult{Scheme: "http", URL: "http://" + address}, nil
+	}
+	<-ctx.Done()
+	return validate.ProtocolResult{}, ctx.Err()
+}
+
+func newStubRegistry(validator validate.Validator, listings *store.Store) *Registry {
+	pipeline := New(nil, listings)
+	pipeline.Checker.Validators = []validate.Validator{validator}
+	pipeline.Workers = 2
+	return pipeline
+}
+
+func TestValidateStopsWhenCancelled(t *testing.T) {
+	validator := &stubValidator{}
+	pipeline := newStubRegistry(validator, store.New(t.TempDir()))
+	proxies := []source.Proxy{{Address: "203.0.113.10:8080"}}
+	for port := 1081; port < 1101; port += 2 {
+		proxies = append(proxies, source.Proxy{Address: "203.0.113.20:" + strconv.Itoa(port)})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan struct{})
+	var results []validate.Result
+	var checked []string
+	go func() {
+		results, checked = pipeline.Validate(ctx, proxies)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("validation did not stop after the cancellation")
+	}
+
+	if len(results) != 1 || results[0].Proxy != "203.0.113.10:8080" {
+		t.Fatalf("results = %+v, want the working proxy only", results)
+	}
+	if len(checked) != 1 || checked[0] != "203.0.113.10:8080" {
+		t.Fatalf("checked = %v, want the interrupted proxies left out", checked)
+	}
+	if started := validator.started.Load(); started > 3 {
+		t.Fatalf("%d checks started, want no new check after the cancellation", started)
+	}
+}
+
+func TestRunKeepsTheListingsWhenCancelledBeforeValidating(t *testing.T) {
+	listings := store.New(t.TempDir())
+	if err := store.WriteFileAtomically(listings.HostsFile, []byte("http://203.0.113.10:8080\n")); err != nil {
+		t.Fatal(err)
+	}
+	pipeline := newStubRegistry(&stubValidator{}, listings)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := pipeline.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	content, err := os.ReadFile(listings.HostsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "http://203.0.113.10:8080\n" {
+		t.Fatalf("hosts = %q, want the previous listing", content)
+	}
+}
+
+func TestPrepareExcludesProxiesWithAHighTamperScore(t *testing.T) {
+	listings := store.New(t.TempDir())
+	history := store.History{
+		"203.0.113.10:8080": {Proxy: "203.0.113.10:8080", TamperScore: 150},
+		"203.0.113.20:8080": {Proxy: "203.0.113.20:8080", TamperScore: 30},
+	}
+	if err := history.Write(listings.HistoryStoreFile); err != nil {
+		t.Fatal(err)
+	}
+	pipeline := New(nil, listings)
+	pipeline.AllowPrivate = true
+	proxies := []source.Proxy{{Address: "203.0.113.10:8080"}, {Address: "203.0.113.20:8080"}, {Address: "203.0.113.30:8080"}}
+
+	prepared := pipeline.Prepare(context.Background(), proxies)
+
+	if len(prepared) != 2 || prepared[0].Address != "203.0.113.20:8080" || prepared[1].Address != "203.0.113.30:8080" {
+		t.Fatalf("prepared = %+v, want the proxy over the threshold excluded", prepared)
+	}
+	pipeline.TamperThreshold = 0
+	if prepared := pipeline.Prepare(context.Background(), proxies); len(prepared) != 3 {
+		t.Fatalf("prepared = %+v, want every proxy without a threshold", prepared)
+	}
+}
+
+func TestPrepareExcludesHostnamesThatResolveToAnExcludedAddress(t *testing.T) {
+	exclusionFile := t.TempDir() + "/exclusion"
+	if err := os.WriteFile(exclusionFile, []byte("127.0.0.0/8\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	exclusions, err := source.LoadExclusionRules(exclusionFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline := New(nil, nil)
+	pipeline.AllowPrivate = true
+	proxies := []source.Proxy{{Address: "localhost:3128"}}
+
+	if prepared := pipeline.Prepare(context.Background(), proxies); len(prepared) != 1 {
+		t.Fatalf("prepared = %+v, want the hostname kept without exclusions", prepared)
+	}
+	pipeline.Exclusions = exclusions
+	if prepared := pipeline.Prepare(context.Background(), proxies); len(prepared) != 0 {
+		t.Fatalf("prepared = %+v, want the hostname on an excluded address dropped", prepared)
+	}
+}
+
+func TestPrepareCountsHostnamesOnReservedAddressesOnTheirSource(t *testing.T) {
+	pipeline := New(nil, nil)
+	reports := []source.SourceReport{{URL: "https://example.com/list.txt"}}
+	proxies := []source.Proxy{{Address: "localhost:3128", Sources: []string{"https://example.com/list.txt"}}}
+
+	if prepared := pipeline.prepare(context.Background(), proxies, reports); len(prepared) != 0 {
+		t.Fatalf("prepared = %+v, want the hostname on a loopback address dropped", prepared)
+	}
+	if reports[0].Reserved != 1 {
+		t.Fatalf("reserved = %d, want the dropped hostname counted on its source", reports[0].Reserved)
+	}
+}
+
+func TestExcludedProxiesComeBackOnlyWhenTheHistoryForgetsThem(t *testing.T) {
+	for _, test := range []struct {
+		retentionDays int
+		excluded      bool
+	}{
+		{30, false},
+		{0, true},
+	} {
+		listings := store.New(t.TempDir())
+		listings.RetentionDays = test.retentionDays
+		caught := time.Now().UTC().AddDate(0, 0, -40)
+		history := store.History{"203.0.113.10:8080": {Proxy: "203.0.113.10:8080", FirstSeen: caught, LastSeen: caught, TamperScore: 150}}
+		if err := history.Write(listings.HistoryStoreFile); err != nil {
+			t.Fatal(err)
+		}
+		pipeline := New(nil, listings)
+		pipeline.AllowPrivate = true
+		proxies := []source.Proxy{{Address: "203.0.113.10:8080"}}
+
+		if prepared := pipeline.Prepare(context.Background(), proxies); len(prepared) != 0 {
+			t.Fatalf("retention %d: prepared = %+v, want the proxy excluded at first", test.retentionDays, prepared)
+		}
+		// Runs that cannot check the proxy leave its score alone, but prune the entry once it is too old.
+		for run := 0; run < 3; run++ {
+			listings.WriteListings(nil, nil)
+		}
+
+		prepared := pipeline.Prepare(context.Background(), proxies)
+		if excluded := len(prepared) == 0; excluded != test.excluded {
+			t.Errorf("retention %d: excluded = %v, want %v", test.retentionDays, excluded, test.excluded)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package registry
+
+import (
+	"encoding/json" // Encodes the API responses
+	"fmt"           // Formats the query error messages
+	"log"           // Implements logging functionality
+	"net/http"      // Provides HTTP client and server implementations
+	"os"            // Provides platform-independent OS functions, including file handling
+	"strconv"       // Parses the numbers of the API queries
+
+	"github.com/complexorganizations/proxy-registry/store"    // The listings being served
+	"github.com/complexorganizations/proxy-registry/validate" // The results held by the listings
+)
+
+// Return the results that match the filters of an API query.
+// Supported filters are protocol, anonymity, family, max_latency_ms, min_uptime and limit.
+func FilterResults(results []validate.Result, query map[string][]string) ([]validate.Result, error) {
+	// Read the filters.
+	get := func(key string) string {
+		if values := query[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	protocol, anonymity, family := get("protocol"), get("anonymity"), get("family")
+	var maxLatencyMS int64
+	var minUptime float64
+	limit := -1
+	var err error
+	if value := get("max_latency_ms"); value != "" {
+		if maxLatencyMS, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid max_latency_ms %q", value)
+		}
+	}
+	if value := get("min_uptime"); value != "" {
+		if minUptime, err = strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("invalid min_uptime %q", value)
+		}
+	}
+	if value := get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid limit %q", value)
+		}
+	}
+	// Keep the results that pass every filter.
+	matched := []validate.Result{}
+	for _, result := range results {
+		if limit >= 0 && len(matched) >= limit {
+			break
+		}
+		if anonymity != "" && result.Anonymity != anonymity {
+			continue
+		}
+		if family != "" && result.Family != family {
+			continue
+		}
+		if maxLatencyMS > 0 && (result.LatencyMS == 0 || result.LatencyMS > maxLatencyMS) {
+			continue
+		}
+		if result.Uptime < minUptime {
+			continue
+		}
+		if protocol != "" {
+			var protocols []validate.ProtocolResult
+			for _, candidate := range result.Protocols {
+				if candidate.Scheme == protocol {
+					protocols = append(protocols, candidate)
+				}
+			}
+			if len(protocols) == 0 {
+				continue
+			}
+			result.Protocols = protocols
+		}
+		matched = append(matched, result)
+	}
+	return matched, nil
+}
+
+// Return a handler that serves the listings of the store and the JSON API, reading the files on every request.
+func NewAPIHandler(listings *store.Store) http.Handler {
+	mux := http.NewServeMux()
+	// The published listings as they are on disk.
+	mux.HandleFunc("/hosts", serveListingFile(listings.HostsFile, "text/plain; charset=utf-8"))
+	mux.HandleFunc("/hosts.json", serveListingFile(listings.HostsJSONFile, "application/json"))
+	mux.HandleFunc("/hosts.ndjson", serveListingFile(listings.HostsNDJSONFile, "application/x-ndjson"))
+	// The published proxies, filtered by the query.
+	mux.HandleFunc("/api/proxies", func(writer http.ResponseWriter, request *http.Request) {
+		if !allowReadOnly(writer, request) {
+			return
+		}
+		results, err := store.ReadListing(listings.HostsJSONFile)
+		if err != nil {
+			log.Println("Error reading listing:", err)
+			http.Error(writer, "listing unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		matched, err := FilterResults(results, request.URL.Query())
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeAPIResponse(writer, matched)
+	})
+	// The statistics of the store.
+	mux.HandleFunc("/api/stats", func(writer http.ResponseWriter, request *http.Request) {
+		if !allowReadOnly(writer, request) {
+			return
+		}
+		stats, err := listings.Stats()
+		if err != nil {
+			log.Println("Error reading statistics:", err)
+			http.Error(writer, "statistics unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		writeAPIResponse(writer, stats)
+	})
+	return mux
+}
+
+// Return a handler that serves the file at the path with the content type.
+func serveListingFile(path string, contentType string) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if !allowReadOnly(writer, request) {
+			return
+		}
+		content, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			http.NotFound(writer, request)
+			return
+		}
+		if err != nil {
+			log.Println("Error reading file:", err)
+			http.Error(writer, "listing unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		writer.Header().Set("Content-Type", contentType)
+		writer.Write(content)
+	}
+}
+
+// Answer anything but GET and HEAD with 405 and report whether the request may go on.
+func allowReadOnly(writer http.ResponseWriter, request *http.Request) bool {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+// Write the value as an indented JSON response.
+func writeAPIResponse(writer http.ResponseWriter, value any) {
+	writer.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		log.Println("Error writing API response:", err)
+	}
+}
@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/complexorganizations/proxy-registry/store"
+	"github.com/complexorganizations/proxy-registry/validate"
+)
+
+func TestAPIProxiesAppliesTheFilters(t *testing.T) {
+	listings := store.New(t.TempDir())
+	content, err := store.EncodeListing("json", []validate.Result{
+		{Proxy: "203.0.113.10:8080", Protocols: []validate.ProtocolResult{{Scheme: "http"}, {Scheme: "socks5"}}, Anonymity: validate.AnonymityElite, LatencyMS: 100, Uptime: 1},
+		{Proxy: "203.0.113.20:1080", Protocols: []validate.ProtocolResult{{Scheme: "socks5"}}, Anonymity: validate.AnonymityTransparent, LatencyMS: 50, Uptime: 1},
+		{Proxy: "203.0.113.30:1080", Protocols: []validate.ProtocolResult{{Scheme: "socks5"}}, Anonymity: validate.AnonymityElite, LatencyMS: 900, Uptime: 0.2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.WriteFileAtomically(listings.HostsJSONFile, content); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(NewAPIHandler(listings))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/api/proxies?protocol=socks5&anonymity=elite&min_uptime=0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var results []validate.Result
+	if err := json.NewDecoder(response.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Proxy != "203.0.113.10:8080" || len(results[0].Protocols) != 1 {
+		t.Fatalf("results = %+v", results)
+	}
+
+	families, err := FilterResults([]validate.Result{
+		{Proxy: "203.0.113.10:8080", Family: "ipv4"},
+		{Proxy: "[2001:db8::1]:8080", Family: "ipv6"},
+	}, map[string][]string{"family": {"ipv6"}})
+	if err != nil || len(families) != 1 || families[0].Proxy != "[2001:db8::1]:8080" {
+		t.Fatalf("family filter = %+v, %v; want the IPv6 proxy only", families, err)
+	}
+
+	bad, err := http.Get(server.URL + "/api/proxies?limit=-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad.Body.Close()
+	if bad.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", bad.StatusCode)
+	}
+}
+
+func TestAPIServesTheListingFiles(t *testing.T) {
+	listings := store.New(t.TempDir())
+	server := httptest.NewServer(NewAPIHandler(listings))
+	defer server.Close()
+
+	missing, err := http.Get(server.URL + "/hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing.Body.Close()
+	if missing.StatusCode != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404 before the first run", missing.StatusCode)
+	}
+	if err := store.WriteFileAtomically(listings.HostsFile, []byte("http://203.0.113.10:8080\n")); err != nil {
+		t.Fatal(err)
+	}
+	found, err := http.Get(server.URL + "/hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found.Body.Close()
+	if found.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", found.StatusCode)
+	}
+}
@@ -0,0 +1,47 @@
+package registry
+
+import (
+	"sync" // Implements synchronization primitives like WaitGroup and Mutex
+
+	"github.com/complexorganizations/proxy-registry/validate" // The results being collected
+)
+
+// Collects the validation results, so validation goroutines never touch the disk.
+type outputSink struct {
+	mutex   sync.Mutex        // Guards the results and the checked addresses
+	results []validate.Result // Results collected so far
+	checked []string          // Addresses whose check ran to the end, working or not
+}
+
+// Create an empty output sink.
+func newOutputSink() *outputSink {
+	return &outputSink{}
+}
+
+// Queue a validated proxy; safe to call from many goroutines.
+func (sink *outputSink) add(result validate.Result) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	sink.results = append(sink.results, result)
+}
+
+// Return a copy of the results collected so far.
+func (sink *outputSink) snapshot() []validate.Result {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	return append([]validate.Result(nil), sink.results...)
+}
+
+// Record that the check of the address ran to the end; safe to call from many goroutines.
+func (sink *outputSink) markChecked(address string) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	sink.checked = append(sink.checked, address)
+}
+
+// Return a copy of the addresses checked so far.
+func (sink *outputSink) checkedAddresses() []string {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	return append([]string(nil), sink.checked...)
+}
@@ -0,0 +1,25 @@
+package registry
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/complexorganizations/proxy-registry/validate"
+)
+
+func TestOutputSinkConcurrentAdds(t *testing.T) {
+	sink := newOutputSink()
+	var waitGroup sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		waitGroup.Add(1)
+		go func(i int) {
+			defer waitGroup.Done()
+			sink.add(validate.Result{Proxy: "203.0.113.1:" + strconv.Itoa(i)})
+		}(i)
+	}
+	waitGroup.Wait()
+	if got := len(sink.snapshot()); got != 100 {
+		t.Fatalf("collected %d results, want 100", got)
+	}
+}
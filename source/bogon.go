@@ -0,0 +1,98 @@
+package source
+
+import (
+	"net/netip" // Parses the addresses and the reserved ranges
+)
+
+// IPv4 ranges that no public proxy can be reached on.
+var reservedIPv4Prefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "This network"
+	netip.MustParsePrefix("10.0.0.0/8"),      // Private (RFC 1918)
+	netip.MustParsePrefix("100.64.0.0/10"),   // Carrier-grade NAT (RFC 6598)
+	netip.MustParsePrefix("127.0.0.0/8"),     // Loopback
+	netip.MustParsePrefix("169.254.0.0/16"),  // Link-local
+	netip.MustParsePrefix("172.16.0.0/12"),   // Private (RFC 1918)
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // Documentation (TEST-NET-1)
+	netip.MustParsePrefix("192.88.99.0/24"),  // Deprecated 6to4 relay anycast
+	netip.MustParsePrefix("192.168.0.0/16"),  // Private (RFC 1918)
+	netip.MustParsePrefix("198.18.0.0/15"),   // Benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // Documentation (TEST-NET-2)
+	netip.MustParsePrefix("203.0.113.0/24"),  // Documentation (TEST-NET-3)
+	netip.MustParsePrefix("224.0.0.0/4"),     // Multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // Reserved, including the broadcast address
+}
+
+// Only global unicast IPv6 addresses are routed on the internet.
+var globalUnicastIPv6Prefix = netip.MustParsePrefix("2000::/3")
+
+// Ranges inside the global unicast space that no public proxy can be reached on.
+var reservedIPv6Prefixes = []netip.Prefix{
+	netip.MustParsePrefix("2001::/23"),     // IETF protocol assignments, including Teredo and benchmarking
+	netip.MustParsePrefix("2001:db8::/32"), // Documentation
+	netip.MustParsePrefix("2002::/16"),     // 6to4, which embeds an IPv4 address of any kind
+	netip.MustParsePrefix("3fff::/20"),     // Documentation
+}
+
+// Report whether the address is unspecified, loopback, private, shared, link-local, documentation,
+// benchmarking, multicast or otherwise reserved, so no public proxy can be reached on it.
+func IsReservedAddress(address netip.Addr) bool {
+	address = address.Unmap()
+	if address.Is4() {
+		return prefixesContain(reservedIPv4Prefixes, address)
+	}
+	return !globalUnicastIPv6Prefix.Contains(address) || prefixesContain(reservedIPv6Prefixes, address.WithZone(""))
+}
+
+// Report whether the proxy is listed by, or resolves to, a reserved address.
+// A hostname is reserved when any of its addresses is, since the dial may pick that one.
+func (proxy Proxy) IsReserved() bool {
+	host, _ := SplitHostPort(proxy.Address)
+	if address, err := netip.ParseAddr(host); err == nil {
+		return IsReservedAddress(address)
+	}
+	for _, ip := range proxy.ResolvedIPs {
+		if address, err := netip.ParseAddr(ip); err == nil && IsReservedAddress(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// Drop the proxies on reserved addresses and return the ones left, along with how many were dropped.
+func DropReserved(proxies []Proxy) ([]Proxy, int) {
+	return DropReservedBySource(proxies, nil)
+}
+
+// Drop the proxies on reserved addresses like DropReserved, adding every dropped proxy to the reserved count of the
+// report of each source that listed it; this is how hostnames that resolved to reserved addresses are attributed.
+func DropReservedBySource(proxies []Proxy, reports []SourceReport) ([]Proxy, int) {
+	// Find the reports by the URL of their source.
+	byURL := make(map[string]*SourceReport, len(reports))
+	for index := range reports {
+		byURL[reports[index].URL] = &reports[index]
+	}
+	kept := make([]Proxy, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !proxy.IsReserved() {
+			kept = append(kept, proxy)
+			continue
+		}
+		for _, url := range proxy.Sources {
+			if report, ok := byURL[url]; ok {
+				report.Reserved++
+			}
+		}
+	}
+	return kept, len(proxies) - len(kept)
+}
+
+// Report whether any of the prefixes contains the address.
+func prefixesContain(prefixes []netip.Prefix, address netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(address) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package source
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestIsReservedAddress(t *testing.T) {
+	tests := map[string]bool{
+		"0.0.0.0":              true,
+		"10.1.2.3":             true,
+		"100.64.0.1":           true,
+		"127.0.0.1":            true,
+		"169.254.1.1":          true,
+		"172.31.255.255":       true,
+		"192.168.1.1":          true,
+		"192.0.2.10":           true,
+		"198.51.100.10":        true,
+		"203.0.113.10":         true,
+		"224.0.0.1":            true,
+		"255.255.255.255":      true,
+		"::ffff:10.0.0.1":      true,
+		"::1":                  true,
+		"fc00::1":              true,
+		"fe80::1":              true,
+		"ff02::1":              true,
+		"2001:db8::1":          true,
+		"8.8.8.8":              false,
+		"172.32.0.1":           false,
+		"100.128.0.1":          false,
+		"2606:4700:4700::1111": false,
+	}
+	for text, want := range tests {
+		if got := IsReservedAddress(netip.MustParseAddr(text)); got != want {
+			t.Errorf("IsReservedAddress(%s) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestDropReservedChecksTheResolvedAddresses(t *testing.T) {
+	proxies := []Proxy{
+		{Address: "192.168.1.1:8080"},
+		{Address: "intranet.example.com:8080", ResolvedIPs: []string{"8.8.8.8", "10.0.0.1"}},
+		{Address: "proxy.example.com:8080", ResolvedIPs: []string{"8.8.4.4"}},
+	}
+	kept, dropped := DropReserved(proxies)
+	if dropped != 2 || len(kept) != 1 || kept[0].Address != "proxy.example.com:8080" {
+		t.Fatalf("kept = %+v, dropped = %d; want the public hostname only", kept, dropped)
+	}
+}
+
+func TestDropReservedBySourceCountsTheDropsOnTheListingSources(t *testing.T) {
+	reports := []SourceReport{{URL: "https://a.example.com/list.txt", Reserved: 2}, {URL: "https://b.example.com/list.txt"}}
+	proxies := []Proxy{
+		{Address: "intranet.example.com:8080", ResolvedIPs: []string{"10.0.0.1"}, Sources: []string{"https://a.example.com/list.txt", "https://b.example.com/list.txt"}},
+		{Address: "lan.example.com:8080", ResolvedIPs: []string{"192.168.1.1"}, Sources: []string{"https://b.example.com/list.txt", "assets/inclusion"}},
+		{Address: "proxy.example.com:8080", ResolvedIPs: []string{"8.8.4.4"}, Sources: []string{"https://a.example.com/list.txt"}},
+	}
+
+	kept, dropped := DropReservedBySource(proxies, reports)
+
+	if dropped != 2 || len(kept) != 1 || kept[0].Address != "proxy.example.com:8080" {
+		t.Fatalf("kept = %+v, dropped = %d; want the public hostname only", kept, dropped)
+	}
+	if reports[0].Reserved != 3 || reports[1].Reserved != 2 {
+		t.Fatalf("reserved = %d, %d; want every drop added to each source that listed it", reports[0].Reserved, reports[1].Reserved)
+	}
+}
@@ -0,0 +1,94 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseProxy(t *testing.T) {
+	tests := []struct {
+		line, proxy, hint string
+	}{
+		{"203.0.113.10:8080", "203.0.113.10:8080", ""},
+		{"socks5://203.0.113.10:1080", "203.0.113.10:1080", "socks5"},
+		{" https://203.0.113.10:443 ", "203.0.113.10:443", "https"},
+	}
+	for _, test := range tests {
+		proxy, err := ParseProxy(test.line)
+		if err != nil || proxy.Address != test.proxy || proxy.Protocol != test.hint {
+			t.Errorf("ParseProxy(%q) = %q, %q, %v; want %q, %q", test.line, proxy.Address, proxy.Protocol, err, test.proxy, test.hint)
+		}
+	}
+	if _, err := ParseProxy("not a proxy"); err == nil {
+		t.Error("ParseProxy accepted a line without a proxy")
+	}
+}
+
+func TestCollectFiltersReservedAddresses(t *testing.T) {
+	feed := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		fmt.Fprintln(writer, "10.0.0.1:3128")
+		fmt.Fprintln(writer, "127.0.0.1:8080")
+		fmt.Fprintln(writer, "[fe80::1]:8080")
+		fmt.Fprintln(writer, "proxy.example.com:8080")
+	}))
+	defer feed.Close()
+	sources := []Source{{URL: feed.URL, Format: "text"}}
+
+	filtered, _ := Collect(context.Background(), nil, sources, nil, nil, false)
+	if len(filtered) != 1 || filtered[0].Address != "proxy.example.com:8080" {
+		t.Fatalf("filtered = %+v, want only the hostname, which is checked once resolved", filtered)
+	}
+	if allowed, _ := Collect(context.Background(), nil, sources, nil, nil, true); len(allowed) != 4 {
+		t.Fatalf("allowed = %+v, want every proxy with allowPrivate", allowed)
+	}
+}
+
+func TestCollectReportsEverySource(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		fmt.Fprintln(writer, "# proxies")
+		fmt.Fprintln(writer, "203.0.113.10:8080")
+		fmt.Fprintln(writer, "203.0.113.20:8080")
+		fmt.Fprintln(writer, "203.0.113.20:8080")
+		fmt.Fprintln(writer, "not a proxy")
+	}))
+	defer healthy.Close()
+	overlapping := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		fmt.Fprintln(writer, "203.0.113.20:8080")
+	}))
+	defer overlapping.Close()
+	dead := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		http.Error(writer, "gone", http.StatusNotFound)
+	}))
+	defer dead.Close()
+	sources := []Source{{URL: healthy.URL, Format: "text"}, {URL: overlapping.URL, Format: "text"}, {URL: dead.URL, Format: "text"}}
+
+	_, reports := Collect(context.Background(), nil, sources, nil, nil, true)
+
+	if len(reports) != 3 {
+		t.Fatalf("reports = %+v, want one per source", reports)
+	}
+	if report := reports[0]; report.Status != http.StatusOK || report.Lines != 4 || report.Parsed != 3 || len(report.Proxies) != 2 || report.Unique != 1 || report.Bytes == 0 || report.Error != "" {
+		t.Errorf("healthy report = %+v, want 4 lines, 3 parsed, 2 proxies of which 1 unique", report)
+	}
+	if report := reports[1]; report.Parsed != 1 || report.Unique != 0 {
+		t.Errorf("overlapping report = %+v, want its only proxy counted as shared", report)
+	}
+	if report := reports[2]; report.Status != http.StatusNotFound || report.Parsed != 0 || report.Error == "" {
+		t.Errorf("dead report = %+v, want the status and an error", report)
+	}
+}
+
+func TestRecordPassedCountsTheEmptyRuns(t *testing.T) {
+	report := SourceReport{Proxies: []string{"203.0.113.10:8080", "203.0.113.20:8080", "203.0.113.30:8080"}}
+	report.RecordPassed(1, &SourceReport{ConsecutiveEmptyRuns: 4})
+	if report.YieldPercent != 33.33 || report.ConsecutiveEmptyRuns != 0 {
+		t.Fatalf("report = %+v, want a yield of 33.33%% and the empty runs reset", report)
+	}
+	report.RecordPassed(0, &SourceReport{ConsecutiveEmptyRuns: 4})
+	if report.YieldPercent != 0 || report.ConsecutiveEmptyRuns != 5 {
+		t.Fatalf("report = %+v, want no yield and a fifth empty run", report)
+	}
+}
@@ -0,0 +1,305 @@
+package source
+
+import (
+	"bufio"         // Splits the bodies into lines
+	"bytes"         // Implements functions for manipulating byte slices
+	"context"       // Cancels the downloads when the run is cancelled
+	"crypto/sha256" // Names the cache files after the feed URLs
+	"encoding/hex"  // Writes the cache file names as text
+	"encoding/json" // Encodes and decodes the cache files
+	"errors"        // Tells the failures worth a retry from the others
+	"fmt"           // Formats the fetch error messages
+	"io"            // Provides basic I/O primitives
+	"log"           // Implements logging functionality
+	"net/http"      // Provides HTTP client and server implementations
+	"os"            // Provides platform-independent OS functions, including file handling
+	"path/filepath" // Joins the cache directory and the file names
+	"sync"          // Implements synchronization primitives like WaitGroup and Mutex
+	"time"          // Provides functionality for measuring and displaying time
+
+	"github.com/complexorganizations/proxy-registry/internal/atomicfile" // Writes the cache files without ever leaving half of one
+)
+
+// User agent sent with every feed request, so the operators of a feed can tell where the traffic comes from.
+const UserAgent = "proxy-registry (+https://github.com/complexorganizations/proxy-registry)"
+
+// Returned for a feed whose body is larger than the fetcher accepts.
+var ErrFeedTooLarge = errors.New("feed is larger than the size limit")
+
+// What fetching a source returned.
+type Feed struct {
+	Lines       []string // Lines of the body; empty unless the source answered 200, or 304 for a cached feed
+	Status      int      // HTTP status of the last answer; zero when none arrived
+	ContentType string   // Content type the source declared
+	Bytes       int64    // Size of the body
+	Attempts    int      // Requests made, retries included
+	Cached      bool     // The source answered that the feed did not change, so the cached body was used
+	Err         error    // Why the feed could not be used; nil when it could
+}
+
+// How the sources are downloaded: how many at a time, how patiently, and how much of them.
+type Fetcher struct {
+	Client      *http.Client  // Client the requests are sent with
+	Concurrency int           // Number of sources fetched at the same time
+	Timeout     time.Duration // Time one request may take, body included; zero means no limit
+	Retries     int           // Requests repeated after a network error or a 5xx answer
+	Backoff     time.Duration // Wait before the first retry, doubled for every retry after it
+	MaxSize     int64         // Largest body read; a larger one fails the feed; zero means no limit
+	CacheDir    string        // Directory the bodies are kept in for conditional requests; empty disables them
+}
+
+// Create a fetcher with the default limits and no cache.
+func NewFetcher() *Fetcher {
+	return &Fetcher{
+		Client:      http.DefaultClient,
+		Concurrency: 8,
+		Timeout:     time.Second * 30,
+		Retries:     3,
+		Backoff:     time.Second,
+		MaxSize:     32 << 20,
+	}
+}
+
+// Send an HTTP GET request to a given URL with the default fetcher and return the lines of the body,
+// along with how the request went.
+func Fetch(ctx context.Context, uri string) Feed {
+	return NewFetcher().Fetch(ctx, uri)
+}
+
+// Fetch every URL, as many at a time as the concurrency allows, and return the feeds in the order of the URLs.
+// Once the context is done the URLs not fetched yet are skipped and their feeds hold the context error.
+func (fetcher *Fetcher) FetchAll(ctx context.Context, uris []string) []Feed {
+	feeds := make([]Feed, len(uris))
+	// Never fetch with fewer than one worker.
+	workerCount := fetcher.Concurrency
+	if workerCount < 1 {
+		workerCount = 1
+	}
+	// Hand out the positions of the URLs, so every worker writes its own feed.
+	queue := make(chan int)
+	var waitGroup sync.WaitGroup
+	for i := 0; i < workerCount; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for index := range queue {
+				feeds[index] = fetcher.Fetch(ctx, uris[index])
+			}
+		}()
+	}
+	// Queue every URL until the run is cancelled.
+	for index := range uris {
+		if ctx.Err() != nil {
+			feeds[index] = Feed{Err: ctx.Err()}
+			continue
+		}
+		queue <- index
+	}
+	close(queue)
+	waitGroup.Wait()
+	return feeds
+}
+
+// Fetch the URL, retrying network errors and 5xx answers with a doubling backoff, and return the lines of the body
+// along with how the request went. With a cache directory, a feed that did not change is read from the cache.
+func (fetcher *Fetcher) Fetch(ctx context.Context, uri string) Feed {
+	cached := fetcher.loadCachedFeed(uri)
+	wait := fetcher.Backoff
+	for attempt := 1; ; attempt++ {
+		feed, fresh, retry := fetcher.fetchOnce(ctx, uri, cached)
+		feed.Attempts = attempt
+		if !retry || attempt > fetcher.Retries || ctx.Err() != nil {
+			return fetcher.finishFeed(uri, feed, fresh, cached)
+		}
+		log.Printf("Retrying %s in %s after %v", uri, wait, feed.Err)
+		// Wait before the next attempt, unless the run is cancelled meanwhile.
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			feed.Err = ctx.Err()
+			return fetcher.finishFeed(uri, feed, nil, cached)
+		}
+		wait *= 2
+	}
+}
+
+// Send one request for the URL, conditional when a cached copy exists, and return the feed along with the body that
+// was downloaded, and whether the failure is worth a retry.
+func (fetcher *Fetcher) fetchOnce(ctx context.Context, uri string, cached *cachedFeed) (Feed, *cachedFeed, bool) {
+	// Bound the whole request, body included.
+	if fetcher.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, fetcher.Timeout)
+		defer cancel()
+	}
+	// Create an HTTP GET request for the URI that is abandoned when the context is done.
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return Feed{Err: err}, nil, false
+	}
+	request.Header.Set("User-Agent", UserAgent)
+	// Ask for the body only when it changed since the cached copy.
+	if cached != nil {
+		if cached.ETag != "" {
+			request.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			request.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	// Perform the request; a network error may well be gone on the next attempt.
+	client := fetcher.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return Feed{Err: err}, nil, true
+	}
+	// Ensure the response body is closed after function execution to prevent resource leaks.
+	defer func() {
+		err = response.Body.Close()
+		if err != nil {
+			log.Println("Error closing response body:", err)
+		}
+	}()
+	feed := Feed{Status: response.StatusCode, ContentType: response.Header.Get("Content-Type")}
+	// The cached copy is still current.
+	if response.StatusCode == http.StatusNotModified && cached != nil {
+		return feed, nil, false
+	}
+	// Read the body, but never more than the size limit.
+	body, err := readLimited(response.Body, response.ContentLength, fetcher.MaxSize)
+	feed.Bytes = int64(len(body))
+	if err != nil {
+		feed.Err = err
+		return feed, nil, !errors.Is(err, ErrFeedTooLarge)
+	}
+	// Anything else than 200 means there is no feed; only a server error may be gone on the next attempt.
+	if response.StatusCode != http.StatusOK {
+		feed.Err = fmt.Errorf("HTTP status %d", response.StatusCode)
+		return feed, nil, response.StatusCode >= http.StatusInternalServerError
+	}
+	fresh := &cachedFeed{
+		URL:          uri,
+		ETag:         response.Header.Get("ETag"),
+		LastModified: response.Header.Get("Last-Modified"),
+		ContentType:  feed.ContentType,
+		Body:         body,
+	}
+	return feed, fresh, false
+}
+
+// Read the body up to the size limit, failing as soon as the declared or the actual size goes over it.
+func readLimited(body io.Reader, declaredSize int64, maxSize int64) ([]byte, error) {
+	if maxSize <= 0 {
+		return io.ReadAll(body)
+	}
+	if declaredSize > maxSize {
+		return nil, fmt.Errorf("%w of %d bytes: %d bytes declared", ErrFeedTooLarge, maxSize, declaredSize)
+	}
+	content, err := io.ReadAll(io.LimitReader(body, maxSize+1))
+	if int64(len(content)) > maxSize {
+		return nil, fmt.Errorf("%w of %d bytes", ErrFeedTooLarge, maxSize)
+	}
+	return content, err
+}
+
+// Complete the feed of the last attempt: take the body from the cache when the source did not change it, cache a new
+// body, log the failure if any, and split the body into lines.
+func (fetcher *Fetcher) finishFeed(uri string, feed Feed, fresh *cachedFeed, cached *cachedFeed) Feed {
+	var body []byte
+	switch {
+	case feed.Err != nil:
+		if feed.Status != 0 {
+			log.Println("Failed to scrape the requested page. HTTP Status:", feed.Status, "URL:", uri, "Error:", feed.Err)
+		} else {
+			log.Println("Error making GET request:", feed.Err)
+		}
+		return feed
+	case fresh == nil:
+		feed.Cached = true
+		feed.Bytes = int64(len(cached.Body))
+		if feed.ContentType == "" {
+			feed.ContentType = cached.ContentType
+		}
+		body = cached.Body
+	default:
+		fetcher.storeCachedFeed(fresh)
+		body = fresh.Body
+	}
+	// Initialize a scanner to read the body line by line.
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Split(bufio.ScanLines) // Set scanner to split input by lines.
+	// Iterate through the scanned lines and append them to the feed.
+	for scanner.Scan() {
+		feed.Lines = append(feed.Lines, scanner.Text())
+	}
+	return feed
+}
+
+// A feed body kept between runs, with what the source said to recognize it by.
+type cachedFeed struct {
+	URL          string `json:"url"`                     // URL of the feed
+	ETag         string `json:"etag,omitempty"`          // ETag the source gave the body
+	LastModified string `json:"last_modified,omitempty"` // When the source says the body last changed
+	ContentType  string `json:"content_type,omitempty"`  // Content type the source declared
+	Body         []byte `json:"body"`                    // The body itself
+}
+
+// Return the path of the cache file of the URL, or nothing without a cache directory.
+func (fetcher *Fetcher) cachePath(uri string) string {
+	if fetcher.CacheDir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(uri))
+	return filepath.Join(fetcher.CacheDir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// Load the cached copy of the URL, or nil when there is none to make a conditional request with.
+func (fetcher *Fetcher) loadCachedFeed(uri string) *cachedFeed {
+	path := fetcher.cachePath(uri)
+	if path == "" {
+		return nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("Error reading feed cache:", err)
+		}
+		return nil
+	}
+	var cached cachedFeed
+	if err := json.Unmarshal(content, &cached); err != nil || cached.URL != uri {
+		log.Println("Ignoring invalid feed cache", path)
+		return nil
+	}
+	return &cached
+}
+
+// Keep the body for the next run when the source gave a way to recognize it, and forget it otherwise.
+func (fetcher *Fetcher) storeCachedFeed(fresh *cachedFeed) {
+	path := fetcher.cachePath(fresh.URL)
+	if path == "" {
+		return
+	}
+	if fresh.ETag == "" && fresh.LastModified == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Println("Error removing feed cache:", err)
+		}
+		return
+	}
+	content, err := json.Marshal(fresh)
+	if err != nil {
+		log.Println("Error encoding feed cache:", err)
+		return
+	}
+	// The cache directory is only created once there is something to keep in it.
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Println("Error creating feed cache directory:", err)
+		return
+	}
+	if err := atomicfile.Write(path, content); err != nil {
+		log.Println("Error writing feed cache:", err)
+	}
+}
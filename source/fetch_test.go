@@ -0,0 +1,131 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Create a fetcher that retries without waiting long, so the tests stay fast.
+func newTestFetcher(t *testing.T) *Fetcher {
+	fetcher := NewFetcher()
+	fetcher.Backoff = time.Millisecond
+	fetcher.CacheDir = t.TempDir()
+	return fetcher
+}
+
+func TestFetchRetriesServerErrors(t *testing.T) {
+	var requests atomic.Int64
+	feed := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if requests.Add(1) < 3 {
+			http.Error(writer, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		if agent := request.Header.Get("User-Agent"); agent != UserAgent {
+			t.Errorf("User-Agent = %q, want %q", agent, UserAgent)
+		}
+		fmt.Fprintln(writer, "203.0.113.10:8080")
+	}))
+	defer feed.Close()
+
+	fetched := newTestFetcher(t).Fetch(context.Background(), feed.URL)
+
+	if fetched.Err != nil || fetched.Attempts != 3 || len(fetched.Lines) != 1 {
+		t.Fatalf("feed = %+v, want the third attempt to succeed", fetched)
+	}
+}
+
+func TestFetchGivesUpOnClientErrorsAndOversizedBodies(t *testing.T) {
+	var requests atomic.Int64
+	feed := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests.Add(1)
+		if request.URL.Path == "/missing" {
+			http.NotFound(writer, request)
+			return
+		}
+		fmt.Fprint(writer, strings.Repeat("203.0.113.10:8080\n", 100))
+	}))
+	defer feed.Close()
+	fetcher := newTestFetcher(t)
+	fetcher.MaxSize = 1000
+
+	if missing := fetcher.Fetch(context.Background(), feed.URL+"/missing"); missing.Err == nil || missing.Status != http.StatusNotFound || missing.Attempts != 1 {
+		t.Errorf("missing feed = %+v, want a single attempt with the 404", missing)
+	}
+	if large := fetcher.Fetch(context.Background(), feed.URL+"/large"); !errors.Is(large.Err, ErrFeedTooLarge) || large.Attempts != 1 || len(large.Lines) != 0 {
+		t.Errorf("large feed = %+v, want it refused at once", large)
+	}
+	if count := requests.Load(); count != 2 {
+		t.Errorf("%d requests, want no retry", count)
+	}
+}
+
+func TestFetchReusesAnUnchangedFeed(t *testing.T) {
+	var downloads atomic.Int64
+	feed := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("If-None-Match") == `"v1"` {
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads.Add(1)
+		writer.Header().Set("ETag", `"v1"`)
+		fmt.Fprintln(writer, "203.0.113.10:8080")
+		fmt.Fprintln(writer, "203.0.113.20:8080")
+	}))
+	defer feed.Close()
+	fetcher := newTestFetcher(t)
+
+	first := fetcher.Fetch(context.Background(), feed.URL)
+	second := fetcher.Fetch(context.Background(), feed.URL)
+
+	if first.Cached || len(first.Lines) != 2 {
+		t.Fatalf("first feed = %+v, want it downloaded", first)
+	}
+	if !second.Cached || second.Status != http.StatusNotModified || len(second.Lines) != 2 || second.Bytes != first.Bytes {
+		t.Fatalf("second feed = %+v, want the cached body", second)
+	}
+	if count := downloads.Load(); count != 1 {
+		t.Fatalf("%d downloads, want the unchanged feed downloaded once", count)
+	}
+}
+
+func TestFetchAllCapsTheConcurrency(t *testing.T) {
+	var mutex sync.Mutex
+	var active, peak int
+	feed := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		active++
+		peak = max(peak, active)
+		mutex.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mutex.Lock()
+		active--
+		mutex.Unlock()
+		fmt.Fprintln(writer, strings.TrimPrefix(request.URL.Path, "/"))
+	}))
+	defer feed.Close()
+	fetcher := newTestFetcher(t)
+	fetcher.Concurrency = 2
+	var uris []string
+	for index := 0; index < 6; index++ {
+		uris = append(uris, fmt.Sprintf("%s/203.0.113.%d:8080", feed.URL, index))
+	}
+
+	feeds := fetcher.FetchAll(context.Background(), uris)
+
+	for index, fetched := range feeds {
+		if want := fmt.Sprintf("203.0.113.%d:8080", index); len(fetched.Lines) != 1 || fetched.Lines[0] != want {
+			t.Errorf("feed %d = %+v, want %s", index, fetched, want)
+		}
+	}
+	if peak > 2 {
+		t.Fatalf("%d requests at the same time, want at most 2", peak)
+	}
+}
@@ -0,0 +1,291 @@
+package source
+
+import (
+	"fmt"       // Formats the rule parsing error messages
+	"log"       // Implements logging functionality
+	"net"       // Provides networking utilities
+	"net/netip" // Parses IP addresses and CIDR ranges
+	"net/url"   // Holds the credentials given for an included proxy
+	"path"      // Matches hostnames against glob patterns
+	"strings"   // Provides string manipulation utilities
+)
+
+// The kinds of rules the exclusion file understands.
+const (
+	exclusionHostPort = "host:port" // Exact host and port, e.g. 1.2.3.4:8080
+	exclusionIP       = "ip"        // Every port of a single address, e.g. 1.2.3.4
+	exclusionCIDR     = "cidr"      // Every address inside a range, e.g. 10.0.0.0/8
+	exclusionHostGlob = "hostname"  // Hostnames matching a glob, e.g. *.example.com
+)
+
+// A single line of the exclusion file and how many proxies it dropped.
+type ExclusionRule struct {
+	text     string       // The rule as written in the file
+	kind     string       // One of the exclusion rule kinds
+	hostPort string       // Normalized host:port for host:port rules
+	address  netip.Addr   // Address for ip rules
+	prefix   netip.Prefix // Range for cidr rules
+	glob     string       // Lowercase pattern for hostname rules
+	matched  int          // Number of proxies dropped by the rule
+}
+
+// A single line of the inclusion file and what happened to it.
+type InclusionRule struct {
+	text          string        // The rule as written in the file, with the credentials redacted
+	list          string        // Path of the inclusion file, recorded as the source of the proxy
+	proxy         string        // The proxy as host:port, without any scheme
+	protocolHint  string        // Scheme given in the file, if any
+	user          *url.Userinfo // Credentials given in the file, if any
+	alreadyListed bool          // Whether a feed listed the proxy as well
+	excluded      bool          // Whether an exclusion rule dropped the proxy
+}
+
+// Read the meaningful lines of a list file, skipping blank lines and # comments.
+func ReadList(path string) []string {
+	// Create a slice to store the meaningful lines.
+	var rules []string
+	// Read the file line by line.
+	for _, line := range ReadLines(path) {
+		// Drop the comment, which may follow the rule after whitespace, and the surrounding whitespace.
+		line = strings.TrimSpace(stripComment(line))
+		// Keep the line only if something is left.
+		if line != "" {
+			rules = append(rules, line)
+		}
+	}
+	// Return the rule lines.
+	return rules
+}
+
+// Split a proxy into its host and port, the port is empty when the proxy has none.
+func SplitHostPort(proxy string) (string, string) {
+	// Try to split the proxy as host:port.
+	host, port, err := net.SplitHostPort(proxy)
+	if err != nil {
+		// Fall back to treating the whole entry as a host.
+		return strings.Trim(proxy, "[]"), ""
+	}
+	// Return the split parts.
+	return host, port
+}
+
+// Parse a single exclusion line into a rule.
+func parseExclusionRule(text string) (*ExclusionRule, error) {
+	// Start with the original text so reports show what the user wrote.
+	rule := &ExclusionRule{text: text}
+	// A slash can only mean a CIDR range.
+	if strings.Contains(text, "/") {
+		prefix, err := netip.ParsePrefix(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR range %q", text)
+		}
+		rule.kind = exclusionCIDR
+		rule.prefix = prefix.Masked()
+		return rule, nil
+	}
+	// A bare address matches every port of that address.
+	if address, err := netip.ParseAddr(strings.Trim(text, "[]")); err == nil {
+		rule.kind = exclusionIP
+		rule.address = address.Unmap()
+		return rule, nil
+	}
+	// A host with a port matches exactly that proxy.
+	if host, port, err := net.SplitHostPort(text); err == nil {
+		if host == "" || !isPort(port) {
+			return nil, fmt.Errorf("invalid host:port %q", text)
+		}
+		rule.kind = exclusionHostPort
+		// Write the host the way the parser does, so [2001:DB8:0::1]:80 matches [2001:db8::1]:80.
+		rule.hostPort = net.JoinHostPort(normalizeHost(host), port)
+		return rule, nil
+	}
+	// Anything else is a hostname, optionally with glob wildcards.
+	if _, err := path.Match(text, ""); err != nil || text == "" || strings.ContainsAny(text, " \t:") {
+		return nil, fmt.Errorf("invalid hostname pattern %q", text)
+	}
+	rule.kind = exclusionHostGlob
+	rule.glob = strings.ToLower(text)
+	return rule, nil
+}
+
+// Load and parse the exclusion file, returning an error that lists every invalid line.
+func LoadExclusionRules(filePath string) ([]*ExclusionRule, error) {
+	// Create slices for the parsed rules and the problems found.
+	var rules []*ExclusionRule
+	var problems []string
+	// Parse each rule line.
+	for _, line := range ReadList(filePath) {
+		rule, err := parseExclusionRule(line)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	// Report all the invalid lines at once.
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid exclusion file %s:\n%s", filePath, strings.Join(problems, "\n"))
+	}
+	// Return the parsed rules.
+	return rules, nil
+}
+
+// Load and parse the inclusion file, returning an error that lists every invalid line.
+func LoadInclusionRules(filePath string) ([]*InclusionRule, error) {
+	// Create slices for the parsed rules and the problems found.
+	var rules []*InclusionRule
+	var problems []string
+	// Parse each rule line.
+	for _, line := range ReadList(filePath) {
+		// Remove any scheme prefix, remembering it as the protocol hint; an inclusion must name a single proxy with a port.
+		proxy, err := ParseProxy(line)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid proxy %q (expected host:port): %v", RedactCredentials(line), err))
+			continue
+		}
+		rules = append(rules, &InclusionRule{text: RedactCredentials(line), list: filePath, proxy: proxy.Address, protocolHint: proxy.Protocol, user: proxy.User})
+	}
+	// Report all the invalid lines at once.
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid inclusion file %s:\n%s", filePath, strings.Join(problems, "\n"))
+	}
+	// Return the parsed rules.
+	return rules, nil
+}
+
+// Report whether the rule matches the given proxy.
+func (rule *ExclusionRule) matches(proxy string) bool {
+	// Split the proxy into the parts the rules look at.
+	host, port := SplitHostPort(proxy)
+	// Compare according to the kind of rule.
+	switch rule.kind {
+	case exclusionHostPort:
+		return port != "" && net.JoinHostPort(normalizeHost(host), port) == rule.hostPort
+	case exclusionIP:
+		address, err := netip.ParseAddr(host)
+		return err == nil && address.Unmap() == rule.address
+	case exclusionCIDR:
+		address, err := netip.ParseAddr(host)
+		return err == nil && rule.prefix.Contains(address.Unmap())
+	case exclusionHostGlob:
+		matched, _ := path.Match(rule.glob, strings.ToLower(host))
+		return matched
+	}
+	// Unknown kinds never match.
+	return false
+}
+
+// Return the first exclusion rule that matches the proxy, or nil if none does.
+func matchExclusionRules(rules []*ExclusionRule, proxy string) *ExclusionRule {
+	// Check every rule in file order.
+	for _, rule := range rules {
+		if rule.matches(proxy) {
+			return rule
+		}
+	}
+	// No rule matched.
+	return nil
+}
+
+// Drop every proxy matched by an exclusion rule, counting the matches on the rules.
+func applyExclusionRules(rules []*ExclusionRule, proxies []string) []string {
+	// Create a slice to store the proxies that survive.
+	var returnSlice []string
+	// Check each proxy against the rules.
+	for _, proxy := range proxies {
+		// Count the match on the first rule that drops the proxy.
+		if rule := matchExclusionRules(rules, proxy); rule != nil {
+			rule.matched++
+			continue
+		}
+		// Keep the proxy.
+		returnSlice = append(returnSlice, proxy)
+	}
+	// Return the remaining proxies.
+	return returnSlice
+}
+
+// Drop every proxy listed by hostname that resolved to an address an exclusion rule matches, counting the matches
+// on the rules; the hostnames themselves were matched when the lists were applied.
+func DropExcludedAddresses(rules []*ExclusionRule, proxies []Proxy) []Proxy {
+	// Create a slice to store the proxies that survive.
+	kept := make([]Proxy, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !excludesResolvedAddress(rules, proxy) {
+			kept = append(kept, proxy)
+		}
+	}
+	// Return the remaining proxies.
+	return kept
+}
+
+// Report whether an exclusion rule matches any resolved address of the proxy, counting the match on that rule.
+func excludesResolvedAddress(rules []*ExclusionRule, proxy Proxy) bool {
+	// Look at every address with the port of the proxy, so ip, cidr and host:port rules all apply.
+	_, port := SplitHostPort(proxy.Address)
+	for _, ip := range proxy.ResolvedIPs {
+		if rule := matchExclusionRules(rules, net.JoinHostPort(ip, port)); rule != nil {
+			rule.matched++
+			return true
+		}
+	}
+	// No rule matched any address.
+	return false
+}
+
+// Add every inclusion that no feed listed, recording the protocol hints and the credentials given in the file.
+func applyInclusionRules(rules []*InclusionRule, proxies []string, protocolHints map[string]string, credentials map[string]*url.Userinfo) []string {
+	// Create a set of the proxies the feeds already listed.
+	listed := make(map[string]bool)
+	for _, proxy := range proxies {
+		listed[proxy] = true
+	}
+	// Add each inclusion that is not already present.
+	for _, rule := range rules {
+		// A hint written in the inclusion file takes precedence over the one from a feed.
+		if rule.protocolHint != "" {
+			protocolHints[rule.proxy] = rule.protocolHint
+		}
+		// So do credentials.
+		if rule.user != nil {
+			credentials[rule.proxy] = rule.user
+		}
+		// Remember whether a feed already listed the proxy.
+		if listed[rule.proxy] {
+			rule.alreadyListed = true
+			continue
+		}
+		// Force the proxy into the list.
+		listed[rule.proxy] = true
+		proxies = append(proxies, rule.proxy)
+	}
+	// Return the extended list.
+	return proxies
+}
+
+// Mark the inclusions that an exclusion rule drops, since exclusions always win.
+func markExcludedInclusions(inclusions []*InclusionRule, exclusions []*ExclusionRule) {
+	// Check each inclusion against the exclusion rules.
+	for _, rule := range inclusions {
+		rule.excluded = matchExclusionRules(exclusions, rule.proxy) != nil
+	}
+}
+
+// Log how many entries each inclusion and exclusion rule matched.
+func LogFilterReport(inclusions []*InclusionRule, exclusions []*ExclusionRule) {
+	// Report each inclusion rule.
+	for _, rule := range inclusions {
+		switch {
+		case rule.excluded:
+			log.Printf("Inclusion %q: 0 entries added (dropped by an exclusion rule)", rule.text)
+		case rule.alreadyListed:
+			log.Printf("Inclusion %q: 0 entries added (already listed by a source)", rule.text)
+		default:
+			log.Printf("Inclusion %q: 1 entry added", rule.text)
+		}
+	}
+	// Report each exclusion rule.
+	for _, rule := range exclusions {
+		log.Printf("Exclusion %q (%s): %d entries dropped", rule.text, rule.kind, rule.matched)
+	}
+}
@@ -0,0 +1,171 @@
+package source
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExclusionRulesMatchIPv6Proxies(t *testing.T) {
+	tests := []struct {
+		rule, proxy string
+		want        bool
+	}{
+		{"[2001:DB8:0::1]:8080", "[2001:db8::1]:8080", true},
+		{"[2001:db8::1]:8080", "[2001:db8::1]:1080", false},
+		{"2001:db8::1", "[2001:db8::1]:1080", true},
+		{"2001:db8::/32", "[2001:db8::1]:1080", true},
+		{"2001:db8::/32", "203.0.113.10:1080", false},
+	}
+	for _, test := range tests {
+		rule, err := parseExclusionRule(test.rule)
+		if err != nil {
+			t.Fatalf("parseExclusionRule(%q): %v", test.rule, err)
+		}
+		if got := rule.matches(test.proxy); got != test.want {
+			t.Errorf("rule %q matches %q = %v, want %v", test.rule, test.proxy, got, test.want)
+		}
+	}
+}
+
+func TestDropExcludedAddressesChecksTheResolvedAddresses(t *testing.T) {
+	rules := []*ExclusionRule{}
+	for _, text := range []string{"198.51.100.7", "203.0.113.0/24", "192.0.2.1:3128"} {
+		rule, err := parseExclusionRule(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, rule)
+	}
+	proxies := []Proxy{
+		{Address: "a.example.com:8080", ResolvedIPs: []string{"8.8.8.8", "198.51.100.7"}},
+		{Address: "b.example.com:8080", ResolvedIPs: []string{"203.0.113.10"}},
+		{Address: "c.example.com:3128", ResolvedIPs: []string{"192.0.2.1"}},
+		{Address: "d.example.com:8080", ResolvedIPs: []string{"192.0.2.1"}},
+		{Address: "8.8.4.4:8080"},
+	}
+
+	kept := DropExcludedAddresses(rules, proxies)
+
+	if len(kept) != 2 || kept[0].Address != "d.example.com:8080" || kept[1].Address != "8.8.4.4:8080" {
+		t.Fatalf("kept = %+v, want the hostname on another port and the proxy listed by address", kept)
+	}
+	if rules[0].matched != 1 || rules[1].matched != 1 || rules[2].matched != 1 {
+		t.Fatalf("matches = %d, %d, %d; want one drop counted on every rule", rules[0].matched, rules[1].matched, rules[2].matched)
+	}
+}
+
+func TestExclusionRules(t *testing.T) {
+	tests := []struct {
+		rule     string
+		kind     string
+		matches  []string
+		misses   []string
+		parseErr bool
+	}{
+		{rule: "203.0.113.10:8080", kind: exclusionHostPort, matches: []string{"203.0.113.10:8080"}, misses: []string{"203.0.113.10:3128", "203.0.113.11:8080"}},
+		{rule: "Proxy.Example.com:3128", kind: exclusionHostPort, matches: []string{"proxy.example.com:3128"}, misses: []string{"proxy.example.com:8080"}},
+		{rule: "203.0.113.10", kind: exclusionIP, matches: []string{"203.0.113.10:8080", "203.0.113.10:3128"}, misses: []string{"203.0.113.11:8080", "proxy.example.com:8080"}},
+		{rule: "203.0.113.0/24", kind: exclusionCIDR, matches: []string{"203.0.113.1:80", "203.0.113.254:8080"}, misses: []string{"203.0.114.1:80", "proxy.example.com:80"}},
+		{rule: "203.0.113.77/24", kind: exclusionCIDR, matches: []string{"203.0.113.1:80"}},
+		{rule: "*.example.com", kind: exclusionHostGlob, matches: []string{"www.example.com:80", "a.b.EXAMPLE.com:8080"}, misses: []string{"example.com:80", "www.example.net:80", "203.0.113.10:80"}},
+		{rule: "example.com", kind: exclusionHostGlob, matches: []string{"example.com:80"}, misses: []string{"www.example.com:80"}},
+		{rule: "proxy-?.example.com", kind: exclusionHostGlob, matches: []string{"proxy-1.example.com:80"}, misses: []string{"proxy-12.example.com:80"}},
+		{rule: "203.0.113.0/33", parseErr: true},
+		{rule: "not-an-ip/24", parseErr: true},
+		{rule: "203.0.113.10:", parseErr: true},
+		{rule: ":8080", parseErr: true},
+		{rule: "203.0.113.10:http", parseErr: true},
+		{rule: "203.0.113.10:70000", parseErr: true},
+		{rule: "[*.example.com", parseErr: true},
+		{rule: "proxy example.com", parseErr: true},
+		{rule: "", parseErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.rule, func(t *testing.T) {
+			rule, err := parseExclusionRule(test.rule)
+			if test.parseErr {
+				if err == nil {
+					t.Fatalf("parseExclusionRule(%q) = %+v, want an error", test.rule, rule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseExclusionRule(%q): %v", test.rule, err)
+			}
+			if rule.kind != test.kind {
+				t.Fatalf("kind = %q, want %q", rule.kind, test.kind)
+			}
+			for _, proxy := range test.matches {
+				if !rule.matches(proxy) {
+					t.Errorf("rule %q does not match %q", test.rule, proxy)
+				}
+			}
+			for _, proxy := range test.misses {
+				if rule.matches(proxy) {
+					t.Errorf("rule %q matches %q", test.rule, proxy)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadExclusionRulesSkipsCommentsAndReportsEveryInvalidLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exclusion")
+	content := "# Ranges we never validate\n\n203.0.113.0/24  # documentation range\n   \n*.example.com\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadExclusionRules(path)
+	if err != nil || len(rules) != 2 || rules[0].text != "203.0.113.0/24" || rules[1].text != "*.example.com" {
+		t.Fatalf("rules = %+v, err = %v; want the two rules without the comments", rules, err)
+	}
+	if err := os.WriteFile(path, []byte("203.0.113.0/33\n203.0.113.10\n203.0.113.10:http\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadExclusionRules(path)
+	if err == nil || !strings.Contains(err.Error(), "203.0.113.0/33") || !strings.Contains(err.Error(), "203.0.113.10:http") {
+		t.Fatalf("err = %v, want both invalid lines named", err)
+	}
+}
+
+func TestInclusionRulesForceProxiesIn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inclusion")
+	content := "# Our own proxies\nsocks5://198.51.100.1:1080\nuser:secret@198.51.100.2:3128\n\n198.51.100.3:8080 # also listed by a feed\n198.51.100.4:8080\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inclusions, err := LoadInclusionRules(path)
+	if err != nil || len(inclusions) != 4 {
+		t.Fatalf("inclusions = %+v, err = %v; want four rules", inclusions, err)
+	}
+	exclusion, err := parseExclusionRule("198.51.100.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exclusions := []*ExclusionRule{exclusion}
+	protocolHints := map[string]string{}
+	credentials := map[string]*url.Userinfo{}
+
+	proxies := applyInclusionRules(inclusions, []string{"198.51.100.3:8080"}, protocolHints, credentials)
+	proxies = applyExclusionRules(exclusions, proxies)
+	markExcludedInclusions(inclusions, exclusions)
+
+	if strings.Join(proxies, " ") != "198.51.100.3:8080 198.51.100.1:1080 198.51.100.2:3128" {
+		t.Fatalf("proxies = %v, want the feed proxy followed by the inclusions that are not excluded", proxies)
+	}
+	if protocolHints["198.51.100.1:1080"] != "socks5" || credentials["198.51.100.2:3128"].Username() != "user" {
+		t.Fatalf("hints = %v, credentials = %v; want the scheme and the credentials of the file kept", protocolHints, credentials)
+	}
+	if !inclusions[2].alreadyListed || !inclusions[3].excluded || inclusions[0].alreadyListed || inclusions[0].excluded {
+		t.Fatalf("inclusions = %+v, want the listed and the excluded rules marked", inclusions)
+	}
+	if err := os.WriteFile(path, []byte("198.51.100.5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadInclusionRules(path); err == nil || !strings.Contains(err.Error(), "198.51.100.5") {
+		t.Fatalf("err = %v, want an inclusion without a port rejected", err)
+	}
+}
@@ -0,0 +1,287 @@
+package source
+
+import (
+	"errors"    // Creates the parse error values
+	"fmt"       // Formats the parse error messages
+	"net"       // Joins the host and the port
+	"net/netip" // Parses and normalizes IP addresses
+	"net/url"   // Holds the credentials of a proxy
+	"regexp"    // Finds the credentials to redact
+	"strconv"   // Parses the port numbers
+	"strings"   // Provides string manipulation utilities
+)
+
+// Returned for lines that are blank or only hold a comment, which are skipped rather than rejected.
+var ErrNoProxy = errors.New("line holds no proxy")
+
+// Address families a proxy can be reached over.
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// Match the credentials of a proxy written as user:pass@host:port and as host:port:user:pass.
+var (
+	leadingCredentialsPattern  = regexp.MustCompile(`[^\s/@,;|"']+@`)
+	trailingCredentialsPattern = regexp.MustCompile(`(:\d{1,5}):[^\s:,;|"']+:[^\s,;|"']*`)
+)
+
+// A proxy as written on a single feed line.
+type Entry struct {
+	Host     string // IP address or hostname, lowercase
+	Port     string // Port number without leading zeros
+	Username string // User name, empty when the proxy needs no credentials
+	Password string // Password, may be empty even with a user name
+	Protocol string // Scheme written on the line, such as "socks5"; empty when none
+}
+
+// Return the entry as host:port, with an IPv6 host in brackets.
+func (entry Entry) Address() string {
+	return net.JoinHostPort(entry.Host, entry.Port)
+}
+
+// Return the address family of a host:port address, or an empty string when the host is not an IP address.
+func AddressFamily(address string) string {
+	host, _ := SplitHostPort(address)
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return ""
+	}
+	if ip.Unmap().Is4() {
+		return FamilyIPv4
+	}
+	return FamilyIPv6
+}
+
+// Return the credentials of the entry, or nil when the proxy needs none.
+func (entry Entry) User() *url.Userinfo {
+	if entry.Username == "" {
+		return nil
+	}
+	// A SOCKS4 user id comes without a password.
+	if entry.Password == "" {
+		return url.User(entry.Username)
+	}
+	return url.UserPassword(entry.Username, entry.Password)
+}
+
+// Replace the credentials written in the text, so it can be logged.
+func RedactCredentials(text string) string {
+	text = leadingCredentialsPattern.ReplaceAllString(text, "xxxxx@")
+	return trailingCredentialsPattern.ReplaceAllString(text, "$1:xxxxx:xxxxx")
+}
+
+// What parsing the lines of a feed produced.
+type feedParseResult struct {
+	entries  []Entry // Proxies found, in the order they were listed
+	lines    int     // Lines that were not blank or comments
+	rejected int     // Lines that held no usable proxy
+	example  string  // The first rejected line and why it was rejected
+}
+
+// Parse a feed line into a proxy, accepting the layouts found in public lists:
+//
+//	203.0.113.10:8080
+//	socks5://203.0.113.10:1080
+//	user:pass@203.0.113.10:8080
+//	203.0.113.10:8080:user:pass
+//	203.0.113.10,8080,US,elite,HTTPS
+//	203.0.113.10:8080 US-H-S + # trailing columns and comments
+//
+// Trailing columns are ignored, except a protocol name, which is used as the hint when the line has no scheme.
+// Blank and comment lines return ErrNoProxy; anything else that holds no proxy returns an error saying why.
+func ParseLine(line string) (Entry, error) {
+	// Drop a byte order mark, the comment and the surrounding whitespace.
+	line = strings.TrimSpace(stripComment(strings.TrimPrefix(line, "\ufeff")))
+	if line == "" || strings.HasPrefix(line, "//") || strings.HasPrefix(line, ";") {
+		return Entry{}, ErrNoProxy
+	}
+	// Split the line into its columns, unquoting each one.
+	fields := strings.FieldsFunc(line, isFieldSeparator)
+	for index, field := range fields {
+		fields[index] = strings.Trim(field, `"'`)
+	}
+	proxyText, columns := fields[0], fields[1:]
+	// A host in one column and its port in the next, as in CSV exports.
+	if len(columns) > 0 && isHost(proxyText) && isPort(columns[0]) {
+		proxyText, columns = net.JoinHostPort(proxyText, columns[0]), columns[1:]
+	}
+	// Parse the proxy itself.
+	entry, err := parseProxyText(proxyText)
+	if err != nil {
+		return Entry{}, err
+	}
+	// Fall back to a protocol named in the other columns.
+	if entry.Protocol == "" {
+		for _, column := range columns {
+			if protocol := strings.ToLower(column); containsString(supportedSourceProtocols, protocol) {
+				entry.Protocol = protocol
+				break
+			}
+		}
+	}
+	return entry, nil
+}
+
+// Return the line without its comment, which starts with a # at the beginning of the line or after whitespace,
+// so a # inside a password, as in user:p#ss@203.0.113.10:3128, is kept.
+func stripComment(line string) string {
+	for index, character := range line {
+		if character == '#' && (index == 0 || line[index-1] == ' ' || line[index-1] == '\t') {
+			return line[:index]
+		}
+	}
+	return line
+}
+
+// Parse a proxy written as [scheme://][user:pass@]host:port[:user:pass].
+func parseProxyText(text string) (Entry, error) {
+	var entry Entry
+	// Remove the scheme, which must be one the validators understand.
+	if scheme, remainder, found := strings.Cut(text, "://"); found {
+		scheme = strings.ToLower(scheme)
+		if !containsString(supportedSourceProtocols, scheme) {
+			return entry, fmt.Errorf("unsupported scheme %q", scheme)
+		}
+		entry.Protocol = scheme
+		text = remainder
+	}
+	// Drop the trailing slash of a proxy written as a URL.
+	text = strings.TrimSuffix(text, "/")
+	// Take the credentials written in front of the host.
+	if at := strings.LastIndex(text, "@"); at >= 0 {
+		entry.Username, entry.Password, _ = strings.Cut(text[:at], ":")
+		if entry.Username == "" {
+			return entry, errors.New("empty user name")
+		}
+		text = text[at+1:]
+	}
+	// Split the host, the port and the credentials written after them; the password may hold colons itself.
+	host, rest, err := splitHost(text)
+	if err != nil {
+		return entry, err
+	}
+	parts := strings.SplitN(rest, ":", 3)
+	switch {
+	case len(parts) == 3 && entry.Username == "":
+		entry.Username, entry.Password = parts[1], parts[2]
+		if entry.Username == "" {
+			return entry, errors.New("empty user name")
+		}
+	case len(parts) != 1:
+		return entry, errors.New("unexpected text after the port")
+	}
+	// Check and normalize the host and the port.
+	if !isHost(host) {
+		return entry, fmt.Errorf("invalid host %q", host)
+	}
+	// A zone only means something on the machine that wrote the feed.
+	if strings.Contains(host, "%") {
+		return entry, fmt.Errorf("IPv6 zone in host %q", host)
+	}
+	entry.Host = normalizeHost(host)
+	port, err := strconv.Atoi(parts[0])
+	if err != nil || port < 1 || port > 65535 {
+		return entry, fmt.Errorf("invalid port %q", parts[0])
+	}
+	entry.Port = strconv.Itoa(port)
+	return entry, nil
+}
+
+// Split the host from the text that follows it, removing the brackets around an IPv6 address.
+func splitHost(text string) (string, string, error) {
+	// A bracketed IPv6 address ends at the closing bracket.
+	if strings.HasPrefix(text, "[") {
+		end := strings.Index(text, "]")
+		if end < 0 {
+			return "", "", fmt.Errorf("unclosed bracket in %q", text)
+		}
+		rest, found := strings.CutPrefix(text[end+1:], ":")
+		if !found {
+			return "", "", fmt.Errorf("missing port in %q", text)
+		}
+		return text[1:end], rest, nil
+	}
+	// Anything else ends at the first colon.
+	host, rest, found := strings.Cut(text, ":")
+	if !found {
+		return "", "", fmt.Errorf("missing port in %q", text)
+	}
+	return host, rest, nil
+}
+
+// Report whether the text is an IP address or a well-formed hostname.
+func isHost(text string) bool {
+	// Any IP address will do.
+	if _, err := netip.ParseAddr(text); err == nil {
+		return true
+	}
+	// A hostname is made of labels of letters, digits and hyphens.
+	if len(text) == 0 || len(text) > 253 {
+		return false
+	}
+	hasLetter := false
+	for _, label := range strings.Split(strings.TrimSuffix(text, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, character := range strings.ToLower(label) {
+			switch {
+			case character >= 'a' && character <= 'z':
+				hasLetter = true
+			case character >= '0' && character <= '9', character == '-':
+			default:
+				return false
+			}
+		}
+	}
+	// Digits and dots alone are a malformed IPv4 address, not a hostname.
+	return hasLetter
+}
+
+// Report whether the text is a port number.
+func isPort(text string) bool {
+	port, err := strconv.Atoi(text)
+	return err == nil && port >= 1 && port <= 65535
+}
+
+// Return the canonical form of the host: the shortest form of an IP address, or the lowercase hostname.
+// An IPv4 address written as an IPv4-mapped IPv6 address becomes a plain IPv4 address.
+func normalizeHost(host string) string {
+	if address, err := netip.ParseAddr(host); err == nil {
+		return address.Unmap().String()
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// Report whether the character separates the columns of a feed line.
+func isFieldSeparator(character rune) bool {
+	switch character {
+	case ' ', '\t', ',', ';', '|':
+		return true
+	}
+	return false
+}
+
+// Parse every line of a feed, counting the lines that hold no usable proxy.
+func parseFeed(lines []string) feedParseResult {
+	var result feedParseResult
+	for _, line := range lines {
+		entry, err := ParseLine(line)
+		// Blank lines and comments are neither proxies nor mistakes.
+		if errors.Is(err, ErrNoProxy) {
+			continue
+		}
+		result.lines++
+		if err != nil {
+			// Keep the first rejection as an example for the log.
+			if result.rejected == 0 {
+				result.example = fmt.Sprintf("%q: %v", RedactCredentials(strings.TrimSpace(line)), err)
+			}
+			result.rejected++
+			continue
+		}
+		result.entries = append(result.entries, entry)
+	}
+	return result
+}
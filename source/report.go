@@ -0,0 +1,70 @@
+package source
+
+import (
+	"math" // Rounds the yield
+)
+
+// How one source did in a run: what it returned, how much of it held proxies, and how many of those worked.
+type SourceReport struct {
+	URL                  string   `json:"url"`                    // URL of the source
+	Status               int      `json:"status"`                 // HTTP status of the answer; zero when none arrived
+	ContentType          string   `json:"content_type,omitempty"` // Content type the source declared, which shows feeds that turned into web pages
+	Error                string   `json:"error,omitempty"`        // Why the feed could not be used
+	Attempts             int      `json:"attempts"`               // Requests made, retries included
+	Cached               bool     `json:"cached,omitempty"`       // The feed did not change since the last run, so the cached body was used
+	Bytes                int64    `json:"bytes"`                  // Size of the body
+	Lines                int      `json:"lines"`                  // Lines that were neither blank nor comments
+	Parsed               int      `json:"parsed"`                 // Lines that held a proxy
+	Reserved             int      `json:"reserved"`               // Proxies dropped for being on reserved addresses
+	Unique               int      `json:"unique"`                 // Proxies no other source listed in the run
+	New                  int      `json:"new"`                    // Proxies the history did not know before the run
+	Passed               int      `json:"passed"`                 // Proxies of the source that passed validation
+	YieldPercent         float64  `json:"yield_percent"`          // Passed proxies as a percentage of the distinct proxies the source listed
+	ConsecutiveEmptyRuns int      `json:"consecutive_empty_runs"` // Runs in a row in which no proxy of the source passed
+	Proxies              []string `json:"-"`                      // Distinct proxies the source listed, as host:port
+}
+
+// Create the report of a source from what it returned and what was parsed from it.
+func newSourceReport(url string, feed Feed, parsed feedParseResult) SourceReport {
+	report := SourceReport{
+		URL:         url,
+		Status:      feed.Status,
+		ContentType: feed.ContentType,
+		Attempts:    feed.Attempts,
+		Cached:      feed.Cached,
+		Bytes:       feed.Bytes,
+		Lines:       parsed.lines,
+		Parsed:      len(parsed.entries),
+	}
+	if feed.Err != nil {
+		report.Error = RedactCredentials(feed.Err.Error())
+	}
+	return report
+}
+
+// Count the proxies of the source that no other source listed, given every source of every proxy.
+func (report *SourceReport) countUnique(proxySources map[string][]string) {
+	report.Unique = 0
+	for _, proxy := range report.Proxies {
+		if len(removeDuplicatesFromSlice(proxySources[proxy])) == 1 {
+			report.Unique++
+		}
+	}
+}
+
+// Record how many proxies of the source passed validation, and the yield that makes.
+// The previous report of the same source carries the count of runs without a working proxy.
+func (report *SourceReport) RecordPassed(passed int, previous *SourceReport) {
+	report.Passed = passed
+	report.YieldPercent = 0
+	if len(report.Proxies) > 0 {
+		report.YieldPercent = math.Round(float64(passed)/float64(len(report.Proxies))*10000) / 100
+	}
+	report.ConsecutiveEmptyRuns = 0
+	if passed == 0 {
+		report.ConsecutiveEmptyRuns = 1
+		if previous != nil {
+			report.ConsecutiveEmptyRuns += previous.ConsecutiveEmptyRuns
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package source
+
+import (
+	"context" // Cancels the lookups when the run is cancelled
+	"fmt"     // Formats the resolver error messages
+	"log"     // Implements logging functionality
+	"net"     // Resolves the hostnames of the proxies
+	"sort"    // Orders the resolved addresses
+	"sync"    // Waits for the lookups running at the same time
+	"time"    // Bounds how long a single lookup may take
+)
+
+// Number of hostnames looked up at the same time.
+const resolveWorkers = 32
+
+// Longest time a single hostname lookup may take.
+const resolveTimeout = 10 * time.Second
+
+// Create a resolver that asks the DNS server at the host[:port] address, or the system resolver when the address is empty.
+func NewResolver(server string) (*net.Resolver, error) {
+	// Without a server the system configuration applies.
+	if server == "" {
+		return net.DefaultResolver, nil
+	}
+	// A bare address means the standard DNS port.
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	host, port, err := net.SplitHostPort(server)
+	if err != nil || host == "" || !isPort(port) {
+		return nil, fmt.Errorf("invalid resolver address %q", server)
+	}
+	// Send every query to the server, whatever the system configuration says.
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, server)
+		},
+	}, nil
+}
+
+// Look up the proxies listed by hostname, recording their addresses, and drop the ones that would be validated twice.
+// A hostname that resolves to a proxy listed by IP address, or to the same address as an earlier hostname, is merged
+// into that proxy; hostnames that do not resolve are dropped, since they cannot be reached.
+func ResolveHostnames(ctx context.Context, resolver *net.Resolver, proxies []Proxy) []Proxy {
+	// Collect every hostname once, however many ports it is listed with.
+	var hostnames []string
+	seen := make(map[string]bool)
+	for _, proxy := range proxies {
+		if host, _ := SplitHostPort(proxy.Address); AddressFamily(proxy.Address) == "" && !seen[host] {
+			seen[host] = true
+			hostnames = append(hostnames, host)
+		}
+	}
+	// Nothing to resolve when every proxy is listed by IP address.
+	if len(hostnames) == 0 {
+		return proxies
+	}
+	addresses := lookupHostnames(ctx, resolver, hostnames)
+	// Work on a copy so the caller's proxies are left as they were.
+	proxies = append([]Proxy(nil), proxies...)
+	// Remember which proxy each ip:port belongs to, starting with the proxies listed by IP address.
+	owners := make(map[string]int)
+	for index, proxy := range proxies {
+		if AddressFamily(proxy.Address) != "" {
+			owners[proxy.Address] = index
+		}
+	}
+	// Keep the proxies listed by IP address and the first hostname of every resolved address.
+	dropped := make([]bool, len(proxies))
+	var unresolved, merged int
+	for index := range proxies {
+		proxy := &proxies[index]
+		host, port := SplitHostPort(proxy.Address)
+		if AddressFamily(proxy.Address) != "" {
+			continue
+		}
+		// A hostname that does not resolve cannot be validated.
+		ips, ok := addresses[host]
+		if !ok {
+			dropped[index] = true
+			unresolved++
+			continue
+		}
+		proxy.ResolvedIPs = ips
+		// Merge the proxy into the one that already owns any of its addresses.
+		owner := -1
+		for _, ip := range ips {
+			if existing, ok := owners[net.JoinHostPort(ip, port)]; ok {
+				owner = existing
+				break
+			}
+		}
+		if owner >= 0 {
+			mergeProxy(&proxies[owner], *proxy)
+			dropped[index] = true
+			merged++
+			continue
+		}
+		for _, ip := range ips {
+			owners[net.JoinHostPort(ip, port)] = index
+		}
+	}
+	// Return the proxies that are left, in their original order.
+	kept := make([]Proxy, 0, len(proxies))
+	for index, proxy := range proxies {
+		if !dropped[index] {
+			kept = append(kept, proxy)
+		}
+	}
+	log.Printf("Resolved %d of %d hostnames: %d proxies did not resolve, %d duplicated another proxy", len(addresses), len(hostnames), unresolved, merged)
+	return kept
+}
+
+// Look up the hostnames and return the sorted addresses of each one that resolved.
+func lookupHostnames(ctx context.Context, resolver *net.Resolver, hostnames []string) map[string][]string {
+	// Look them up with a few workers at a time.
+	addresses := make(map[string][]string)
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	queue := make(chan string)
+	for i := 0; i < resolveWorkers && i < len(hostnames); i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for hostname := range queue {
+				ips, err := lookupHostname(ctx, resolver, hostname)
+				if err != nil {
+					continue
+				}
+				mutex.Lock()
+				addresses[hostname] = ips
+				mutex.Unlock()
+			}
+		}()
+	}
+	// Queue the hostnames until the run is cancelled.
+queueing:
+	for _, hostname := range hostnames {
+		select {
+		case queue <- hostname:
+		case <-ctx.Done():
+			break queueing
+		}
+	}
+	close(queue)
+	waitGroup.Wait()
+	return addresses
+}
+
+// Look up a single hostname and return its addresses, IPv4 first, in their canonical form.
+func lookupHostname(ctx context.Context, resolver *net.Resolver, hostname string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+	found, err := resolver.LookupNetIP(ctx, "ip", hostname)
+	if err != nil {
+		return nil, err
+	}
+	// Sort the addresses so the record does not change from one run to the next.
+	for index, address := range found {
+		found[index] = address.Unmap()
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Less(found[j]) })
+	var ips []string
+	for index, address := range found {
+		// Drop the duplicates a resolver may return for the A and AAAA records.
+		if index > 0 && address == found[index-1] {
+			continue
+		}
+		ips = append(ips, address.WithZone("").String())
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", hostname)
+	}
+	return ips, nil
+}
+
+// Add what is known about the duplicate to the proxy it duplicates.
+func mergeProxy(proxy *Proxy, duplicate Proxy) {
+	proxy.Sources = removeDuplicatesFromSlice(append(proxy.Sources, duplicate.Sources...))
+	if proxy.Protocol == "" {
+		proxy.Protocol = duplicate.Protocol
+	}
+	if proxy.User == nil {
+		proxy.User = duplicate.User
+	}
+}
@@ -0,0 +1,51 @@
+package source
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+)
+
+func TestResolveHostnamesMergesDuplicates(t *testing.T) {
+	proxies := []Proxy{
+		{Address: "127.0.0.1:8080", Sources: []string{"a"}},
+		{Address: "localhost:8080", Protocol: "socks5", Sources: []string{"b"}},
+		{Address: "localhost:3128", Sources: []string{"c"}},
+		{Address: "proxy.invalid:3128", Sources: []string{"d"}},
+	}
+
+	resolved := ResolveHostnames(context.Background(), net.DefaultResolver, proxies)
+
+	if len(resolved) != 2 {
+		t.Fatalf("resolved = %+v, want the IP proxy and localhost:3128", resolved)
+	}
+	// The hostname on the same port as the IP proxy is merged into it.
+	if resolved[0].Address != "127.0.0.1:8080" || !slices.Equal(resolved[0].Sources, []string{"a", "b"}) || resolved[0].Protocol != "socks5" {
+		t.Errorf("merged proxy = %+v", resolved[0])
+	}
+	// The hostname on another port is kept with the addresses it resolved to.
+	if resolved[1].Address != "localhost:3128" || !slices.Contains(resolved[1].ResolvedIPs, "127.0.0.1") || resolved[1].Family() != FamilyIPv4 {
+		t.Errorf("hostname proxy = %+v", resolved[1])
+	}
+	// The caller's proxies are left as they were.
+	if proxies[2].ResolvedIPs != nil || len(proxies[0].Sources) != 1 {
+		t.Errorf("input was modified: %+v", proxies)
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	if resolver, err := NewResolver(""); err != nil || resolver != net.DefaultResolver {
+		t.Errorf("NewResolver(\"\") = %v, %v; want the system resolver", resolver, err)
+	}
+	for _, server := range []string{"1.1.1.1", "1.1.1.1:53", "[2606:4700:4700::1111]:53", "dns.example.com"} {
+		if _, err := NewResolver(server); err != nil {
+			t.Errorf("NewResolver(%q): %v", server, err)
+		}
+	}
+	for _, server := range []string{":53", "1.1.1.1:0", "1.1.1.1:dns"} {
+		if _, err := NewResolver(server); err == nil {
+			t.Errorf("NewResolver(%q) accepted an invalid address", server)
+		}
+	}
+}
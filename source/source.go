@@ -0,0 +1,140 @@
+// Package source loads the configured proxy feeds, fetches them and applies the inclusion and exclusion lists.
+package source
+
+import (
+	"bytes"         // Implements functions for manipulating byte slices
+	"encoding/json" // Decodes the JSON sources file
+	"errors"        // Combines multiple validation errors into one
+	"fmt"           // Formats the validation error messages
+	"net/url"       // Handles URL parsing and manipulation
+	"os"            // Provides platform-independent OS functions, including file handling
+	"strings"       // Provides string manipulation utilities
+)
+
+var (
+	// Formats a source may declare; every line of a "text" feed holds one proxy.
+	supportedSourceFormats = []string{
+		"text",
+	}
+	// Protocol hints a source may declare; they match the schemes of the validators.
+	supportedSourceProtocols = []string{
+		"http",
+		"https",
+		"socks4",
+		"socks4a",
+		"socks5",
+	}
+)
+
+// A single upstream proxy feed as described in the sources file.
+type Source struct {
+	URL      string   `json:"url"`                // Location of the feed
+	Protocol string   `json:"protocol,omitempty"` // Optional protocol the feed claims its proxies speak
+	Format   string   `json:"format"`             // Layout of the feed content
+	Enabled  *bool    `json:"enabled,omitempty"`  // Whether the feed is scraped; omitted means enabled
+	Tags     []string `json:"tags,omitempty"`     // Free-form labels for grouping feeds
+}
+
+// The top level layout of the sources file.
+type fileContent struct {
+	Sources []Source `json:"sources"` // All the configured feeds
+}
+
+// Report whether the source should be scraped.
+func (source Source) IsEnabled() bool {
+	// A missing enabled flag keeps the source active.
+	return source.Enabled == nil || *source.Enabled
+}
+
+// Read the sources file at the given path, validate it, and return the configured sources.
+func LoadFile(path string) ([]Source, error) {
+	// Read the whole sources file into memory.
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading sources file %s: %w", path, err)
+	}
+	// Decode the JSON and reject unknown keys so typos are reported instead of ignored.
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	var fileContent fileContent
+	if err := decoder.Decode(&fileContent); err != nil {
+		return nil, fmt.Errorf("parsing sources file %s: %w", path, err)
+	}
+	// Validate every entry and report all the problems at once.
+	if err := validateSources(fileContent.Sources); err != nil {
+		return nil, fmt.Errorf("invalid sources file %s:\n%w", path, err)
+	}
+	// Return the validated sources.
+	return fileContent.Sources, nil
+}
+
+// Check every source for problems and return an error describing all of them, or nil if they are valid.
+func validateSources(sources []Source) error {
+	// Collect every problem instead of stopping at the first one.
+	var problems []error
+	// An empty file would silently produce an empty hosts list.
+	if len(sources) == 0 {
+		return errors.New("no sources are defined")
+	}
+	// Track the URLs seen so far to catch duplicates.
+	seen := make(map[string]int)
+	// Track whether at least one source is enabled.
+	enabledCount := 0
+	// Inspect each source in the order it appears in the file.
+	for index, source := range sources {
+		// Describe the entry with its 1-based position so users can find it in the file.
+		entry := fmt.Sprintf("entry %d", index+1)
+		if source.URL != "" {
+			entry = fmt.Sprintf("entry %d (%s)", index+1, source.URL)
+		}
+		// The URL is required and must be an absolute http or https URL.
+		if source.URL == "" {
+			problems = append(problems, fmt.Errorf("%s: missing \"url\"", entry))
+		} else if parsedURL, err := url.ParseRequestURI(source.URL); err != nil || parsedURL.Host == "" || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+			problems = append(problems, fmt.Errorf("%s: \"url\" must be an absolute http or https URL", entry))
+		} else if firstIndex, ok := seen[source.URL]; ok {
+			problems = append(problems, fmt.Errorf("%s: duplicate of entry %d", entry, firstIndex+1))
+		} else {
+			seen[source.URL] = index
+		}
+		// The protocol hint is optional, but must be one the validator understands.
+		if source.Protocol != "" && !containsString(supportedSourceProtocols, source.Protocol) {
+			problems = append(problems, fmt.Errorf("%s: unknown \"protocol\" %q (expected one of: %s)", entry, source.Protocol, strings.Join(supportedSourceProtocols, ", ")))
+		}
+		// The format is required so new layouts are never parsed by accident.
+		if source.Format == "" {
+			problems = append(problems, fmt.Errorf("%s: missing \"format\" (expected one of: %s)", entry, strings.Join(supportedSourceFormats, ", ")))
+		} else if !containsString(supportedSourceFormats, source.Format) {
+			problems = append(problems, fmt.Errorf("%s: unknown \"format\" %q (expected one of: %s)", entry, source.Format, strings.Join(supportedSourceFormats, ", ")))
+		}
+		// Tags must not be blank.
+		for _, tag := range source.Tags {
+			if strings.TrimSpace(tag) == "" {
+				problems = append(problems, fmt.Errorf("%s: tags must not be empty", entry))
+				break
+			}
+		}
+		// Count the sources that will actually be scraped.
+		if source.IsEnabled() {
+			enabledCount++
+		}
+	}
+	// A file where everything is disabled would silently produce an empty hosts list.
+	if enabledCount == 0 {
+		problems = append(problems, errors.New("every source is disabled"))
+	}
+	// Combine the problems into a single error, one per line.
+	return errors.Join(problems...)
+}
+
+// Check if the slice contains the given string.
+func containsString(slice []string, value string) bool {
+	// Compare every element with the value.
+	for _, content := range slice {
+		if content == value {
+			return true
+		}
+	}
+	// The value was not found.
+	return false
+}
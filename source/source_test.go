@@ -0,0 +1,89 @@
+package source
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadFileNamesTheInvalidSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "missing url",
+			content: `{"sources": [{"format": "text"}, {"url": "https://example.com/a.txt", "format": "text"}]}`,
+			want:    []string{`entry 1: missing "url"`},
+		},
+		{
+			name:    "missing format",
+			content: `{"sources": [{"url": "https://example.com/a.txt"}]}`,
+			want:    []string{`entry 1 (https://example.com/a.txt): missing "format"`},
+		},
+		{
+			name:    "unsupported scheme",
+			content: `{"sources": [{"url": "ftp://example.com/a.txt", "format": "text"}, {"url": "https://example.com/b.txt", "format": "text"}]}`,
+			want:    []string{`entry 1 (ftp://example.com/a.txt): "url" must be an absolute http or https URL`},
+		},
+		{
+			name:    "duplicate url",
+			content: `{"sources": [{"url": "https://example.com/a.txt", "format": "text"}, {"url": "https://example.com/a.txt", "format": "text"}]}`,
+			want:    []string{"entry 2 (https://example.com/a.txt): duplicate of entry 1"},
+		},
+		{
+			name:    "unknown protocol",
+			content: `{"sources": [{"url": "https://example.com/a.txt", "protocol": "socks6", "format": "text"}]}`,
+			want:    []string{`entry 1 (https://example.com/a.txt): unknown "protocol" "socks6"`},
+		},
+		{
+			name:    "every source disabled",
+			content: `{"sources": [{"url": "https://example.com/a.txt", "format": "text", "enabled": false}]}`,
+			want:    []string{"every source is disabled"},
+		},
+		{
+			name:    "every problem at once",
+			content: `{"sources": [{"url": "https://example.com/a.txt"}, {"url": "https://example.com/b.txt", "protocol": "socks6", "format": "text"}]}`,
+			want:    []string{`entry 1 (https://example.com/a.txt): missing "format"`, `entry 2 (https://example.com/b.txt): unknown "protocol"`},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "sources.json")
+			if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadFile(path)
+			if err == nil {
+				t.Fatal("expected the sources file to be rejected")
+			}
+			for _, want := range append(test.want, path) {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("err = %v, want it to mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFileRejectsUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sources.json")
+	if err := os.WriteFile(path, []byte(`{"sources": [{"url": "https://example.com/a.txt", "format": "text", "protocols": "http"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(path); err == nil || !strings.Contains(err.Error(), "protocols") {
+		t.Fatalf("err = %v, want the misspelled key named", err)
+	}
+}
+
+func TestLoadFileAcceptsTheShippedSources(t *testing.T) {
+	sources, err := LoadFile(filepath.Join("..", "assets", "sources.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) == 0 {
+		t.Fatal("expected the shipped sources file to list sources")
+	}
+}
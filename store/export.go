@@ -0,0 +1,104 @@
+package store
+
+import (
+	"bufio"         // Reads the NDJSON listing line by line
+	"bytes"         // Implements functions for manipulating byte slices
+	"encoding/csv"  // Writes the CSV export
+	"encoding/json" // Decodes the structured listings
+	"fmt"           // Formats the export error messages
+	"os"            // Provides platform-independent OS functions, including file handling
+	"strconv"       // Converts the numbers of the CSV export
+	"strings"       // Provides string manipulation utilities
+	"time"          // Provides functionality for measuring and displaying time
+
+	"github.com/complexorganizations/proxy-registry/validate" // The results held by the listings
+)
+
+// Formats a listing can be encoded in.
+var ExportFormats = []string{"text", "json", "ndjson", "csv"}
+
+// Read the results of a hosts.json or hosts.ndjson listing, told apart by the file extension.
+func ReadListing(path string) ([]validate.Result, error) {
+	// Read the whole listing into memory.
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// An NDJSON listing holds one result per line.
+	if strings.HasSuffix(path, ".ndjson") {
+		var results []validate.Result
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		scanner.Buffer(nil, 1<<20)
+		for line := 1; scanner.Scan(); line++ {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			var result validate.Result
+			if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+			}
+			results = append(results, result)
+		}
+		return results, scanner.Err()
+	}
+	// Anything else is a JSON listing.
+	var listing Listing
+	if err := json.Unmarshal(content, &listing); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return listing.Proxies, nil
+}
+
+// Encode the results in the given export format.
+func EncodeListing(format string, results []validate.Result) ([]byte, error) {
+	switch format {
+	case "text":
+		return encodeTextListing(results), nil
+	case "json":
+		return encodeJSONListing(results)
+	case "ndjson":
+		return encodeNDJSONListing(results)
+	case "csv":
+		return encodeCSVListing(results)
+	}
+	return nil, fmt.Errorf("unsupported format %q, expected one of %s", format, strings.Join(ExportFormats, ", "))
+}
+
+// Encode the results as the sorted scheme://host:port lines of the hosts file.
+// Authenticated proxies are written with their credentials so every line is usable.
+func encodeTextListing(results []validate.Result) []byte {
+	var content bytes.Buffer
+	for _, url := range sortedUnique(validate.URLsWithCredentials(results)) {
+		content.WriteString(url + "\n")
+	}
+	return content.Bytes()
+}
+
+// Encode the results as CSV, one row per working protocol so every row is a usable proxy URL.
+func encodeCSVListing(results []validate.Result) ([]byte, error) {
+	var content bytes.Buffer
+	writer := csv.NewWriter(&content)
+	// Write the header.
+	rows := [][]string{{"proxy", "scheme", "url", "family", "anonymity", "latency_ms", "throughput_bps", "uptime", "first_seen", "last_checked"}}
+	// Write one row per protocol.
+	for _, result := range results {
+		for _, protocol := range result.Protocols {
+			rows = append(rows, []string{
+				result.Proxy,
+				protocol.Scheme,
+				protocol.URL,
+				result.Family,
+				result.Anonymity,
+				strconv.FormatInt(protocol.LatencyMS, 10),
+				strconv.FormatInt(result.Throughput, 10),
+				strconv.FormatFloat(result.Uptime, 'f', -1, 64),
+				result.FirstSeen.Format(time.RFC3339),
+				result.LastChecked.Format(time.RFC3339),
+			})
+		}
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return content.Bytes(), nil
+}
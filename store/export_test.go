@@ -0,0 +1,65 @@
+package store
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/complexorganizations/proxy-registry/validate"
+)
+
+func exportTestResults() []validate.Result {
+	checkedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	return []validate.Result{
+		{
+			Proxy:       "203.0.113.10:8080",
+			Family:      "ipv4",
+			Protocols:   []validate.ProtocolResult{{Scheme: "http", URL: "http://203.0.113.10:8080", LatencyMS: 120}, {Scheme: "socks5", URL: "socks5://203.0.113.10:8080", LatencyMS: 90}},
+			Anonymity:   validate.AnonymityElite,
+			LatencyMS:   90,
+			Uptime:      0.5,
+			FirstSeen:   checkedAt,
+			LastChecked: checkedAt,
+		},
+	}
+}
+
+func TestEncodeListingWritesCSVRows(t *testing.T) {
+	content, err := EncodeListing("csv", exportTestResults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "proxy,scheme,url") {
+		t.Fatalf("csv = %q", content)
+	}
+	if lines[2] != "203.0.113.10:8080,socks5,socks5://203.0.113.10:8080,ipv4,elite,90,0,0.5,2026-01-02T03:04:05Z,2026-01-02T03:04:05Z" {
+		t.Errorf("csv row = %q", lines[2])
+	}
+}
+
+func TestReadListingRoundTripsBothFormats(t *testing.T) {
+	directory := t.TempDir()
+	for _, name := range []string{"hosts.json", "hosts.ndjson"} {
+		path := filepath.Join(directory, name)
+		if name == "hosts.json" {
+			writeJSONListing(path, exportTestResults())
+		} else {
+			writeNDJSONListing(path, exportTestResults())
+		}
+		results, err := ReadListing(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || len(results[0].Protocols) != 2 {
+			t.Fatalf("%s round trip lost data: %+v", name, results)
+		}
+	}
+}
+
+func TestEncodeListingRejectsAnUnknownFormat(t *testing.T) {
+	if _, err := EncodeListing("xml", exportTestResults()); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"bytes" // Implements functions for manipulating byte slices
+	"log"   // Implements logging functionality
+	"sort"  // Implements sorting functions
+
+	"github.com/complexorganizations/proxy-registry/internal/atomicfile" // Replaces the files without ever exposing half of one
+)
+
+// Replace the file at the given path with the content so readers see either the old or the new file, never a partial one.
+func WriteFileAtomically(path string, content []byte) error {
+	return atomicfile.Write(path, content)
+}
+
+// Write a slice of strings to a file, one per line.
+// If the file already exists, it is replaced atomically, so it is never seen empty or half written.
+func appendAndWriteSliceToAFile(filename string, content []string) {
+	// Create a buffer to hold the whole file.
+	var datawriter bytes.Buffer
+	// Write each string in the content slice to the buffer, one line at a time.
+	for _, data := range content {
+		datawriter.WriteString(data + "\n")
+	}
+	// Replace the file with the buffer content. If an error occurs, log the error and keep the old file.
+	if err := WriteFileAtomically(filename, datawriter.Bytes()); err != nil {
+		log.Println("Error writing file:", err)
+	}
+}
+
+// Cleanup the content provided for a file, sort it, and save it in place of the file.
+func cleanupTheFiles(path string, content []string) {
+	// Remove any duplicate lines from the content and sort what is left.
+	finalCleanupContent := sortedUnique(content)
+	// Replace the file with the cleaned up and sorted content.
+	appendAndWriteSliceToAFile(path, finalCleanupContent)
+}
+
+// Return the strings without duplicates, in ascending order.
+func sortedUnique(slice []string) []string {
+	// Create a map to track unique elements (the keys will be the elements).
+	check := make(map[string]bool)
+	// Create a new slice to store only the unique elements.
+	var newReturnSlice []string
+	for _, content := range slice {
+		if !check[content] {
+			check[content] = true
+			newReturnSlice = append(newReturnSlice, content)
+		}
+	}
+	// Sort the unique elements.
+	sort.Strings(newReturnSlice)
+	return newReturnSlice
+}
@@ -0,0 +1,30 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomicallyReplacesTheFile(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "hosts")
+	if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	appendAndWriteSliceToAFile(path, []string{"http://203.0.113.1:80", "http://203.0.113.2:80"})
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "http://203.0.113.1:80\nhttp://203.0.113.2:80\n"; string(content) != want {
+		t.Fatalf("content = %q, want %q", content, want)
+	}
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("found %d files, want only the replaced file to remain", len(entries))
+	}
+}
@@ -0,0 +1,232 @@
+package store
+
+import (
+	"encoding/json" // Encodes and decodes the history store
+	"fmt"           // Formats the history error messages
+	"os"            // Provides platform-independent OS functions, including file handling
+	"sort"          // Implements sorting functions
+	"time"          // Provides functionality for measuring and displaying time
+
+	"github.com/complexorganizations/proxy-registry/source"   // Parses the lines of the plain history file
+	"github.com/complexorganizations/proxy-registry/validate" // The validation results recorded in the history
+)
+
+// What the registry remembers about a proxy across runs.
+type HistoryEntry struct {
+	Proxy               string    `json:"proxy"`                    // The proxy as host:port
+	URLs                []string  `json:"urls,omitempty"`           // Every scheme://host:port the proxy ever validated with
+	FirstSeen           time.Time `json:"first_seen"`               // When a source first listed the proxy
+	LastSeen            time.Time `json:"last_seen"`                // When a source last listed the proxy
+	LastSuccess         time.Time `json:"last_success"`             // When the proxy last passed validation; zero if it never did
+	Checks              int       `json:"checks"`                   // Number of runs the proxy was validated in
+	Successes           int       `json:"successes"`                // Number of runs the proxy passed validation in
+	ConsecutiveFailures int       `json:"consecutive_failures"`     // Number of runs in a row the proxy failed validation
+	Uptime              float64   `json:"uptime"`                   // Successes divided by checks, from 0 to 1
+	TamperScore         float64   `json:"tamper_score,omitempty"`   // Tampering signals caught, halved by every run; high scores are excluded from validation
+	LastTampering       string    `json:"last_tampering,omitempty"` // Why the proxy was last caught tampering with the traffic
+}
+
+// Everything the registry remembers, keyed by proxy.
+type History map[string]*HistoryEntry
+
+// The layout of the history store file.
+type historyFile struct {
+	UpdatedAt time.Time      `json:"updated_at"` // When the store was written
+	Count     int            `json:"count"`      // Number of proxies in the store
+	Proxies   []HistoryEntry `json:"proxies"`    // The proxies, sorted by address
+}
+
+// Load the history store, keyed by proxy.
+// When the store does not exist yet, it is seeded from the URLs of the plain history file so nothing is lost;
+// the seeded entries count as first seen now, so the retention period starts with the store.
+func LoadHistory(storePath string, legacyPath string) (History, error) {
+	// Create a map to store the entries.
+	history := make(History)
+	// Read the store; a missing one is seeded from the plain history file.
+	content, err := os.ReadFile(storePath)
+	if os.IsNotExist(err) {
+		seededAt := time.Now().UTC().Truncate(time.Second)
+		for _, line := range source.ReadLines(legacyPath) {
+			proxy, err := source.ParseProxy(line)
+			if err != nil {
+				continue
+			}
+			entry := history.entryFor(proxy.Address)
+			entry.URLs = appendUniqueString(entry.URLs, line)
+			if entry.FirstSeen.IsZero() {
+				entry.FirstSeen = seededAt
+			}
+		}
+		return history, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Decode the store.
+	var stored historyFile
+	if err := json.Unmarshal(content, &stored); err != nil {
+		return nil, fmt.Errorf("reading history store %s: %w", storePath, err)
+	}
+	for index := range stored.Proxies {
+		history[stored.Proxies[index].Proxy] = &stored.Proxies[index]
+	}
+	// Return the entries.
+	return history, nil
+}
+
+// Return the entry of the proxy, creating an empty one when the proxy is new.
+func (history History) entryFor(proxy string) *HistoryEntry {
+	entry, ok := history[proxy]
+	if !ok {
+		entry = &HistoryEntry{Proxy: proxy}
+		history[proxy] = entry
+	}
+	return entry
+}
+
+// Record one run in the history: every checked proxy was seen, and the results are the ones that passed, except the
+// ones caught tampering, which count as failures and add their score to the tamper score instead.
+// Every run halves the tamper score of the proxies it checked, so a proxy caught once is forgiven in time.
+func (history History) Update(checked []string, results []validate.Result, now time.Time) {
+	// Every proxy validated in this run was listed by a source or the inclusion list.
+	for _, proxy := range checked {
+		entry := history.entryFor(proxy)
+		if entry.FirstSeen.IsZero() {
+			entry.FirstSeen = now
+		}
+		entry.LastSeen = now
+		entry.Checks++
+		entry.ConsecutiveFailures++
+		entry.TamperScore = decayTamperScore(entry.TamperScore)
+	}
+	// The results are the proxies that passed, or were caught tampering.
+	for _, result := range results {
+		entry := history.entryFor(result.Proxy)
+		if result.Tampered() {
+			entry.TamperScore += float64(result.TamperScore)
+			entry.LastTampering = result.Tampering
+			continue
+		}
+		entry.LastSuccess = now
+		entry.Successes++
+		entry.ConsecutiveFailures = 0
+		for _, protocol := range result.Protocols {
+			entry.URLs = appendUniqueString(entry.URLs, protocol.URL)
+		}
+	}
+	// Recompute the uptime of every entry.
+	for _, entry := range history {
+		entry.Uptime = uptimeRatio(entry.Successes, entry.Checks)
+	}
+}
+
+// What a history pruning removed.
+type PruneSummary struct {
+	Expired  int // Entries that did not pass validation within the retention period
+	Failures int // Entries that failed too many runs in a row
+	Kept     int // Entries left in the history
+}
+
+// Remove the entries that broke a retention rule and report what was removed.
+// An entry that never passed validation is aged from when it was first seen, and one without either time,
+// such as an entry seeded by an earlier version, is left to the next runs.
+func (history History) Prune(now time.Time, retentionDays int, maxFailures int) PruneSummary {
+	// Create a value to store the summary.
+	var summary PruneSummary
+	// The oldest success, or first sighting, that is still kept.
+	cutoff := now.AddDate(0, 0, -retentionDays)
+	for proxy, entry := range history {
+		// Age the entry from its last success, or from when it was first seen if it never worked.
+		lastGood := entry.LastSuccess
+		if lastGood.IsZero() {
+			lastGood = entry.FirstSeen
+		}
+		switch {
+		case retentionDays > 0 && !lastGood.IsZero() && lastGood.Before(cutoff):
+			summary.Expired++
+			delete(history, proxy)
+		case maxFailures > 0 && entry.ConsecutiveFailures >= maxFailures:
+			summary.Failures++
+			delete(history, proxy)
+		default:
+			summary.Kept++
+		}
+	}
+	// Return the summary.
+	return summary
+}
+
+// Halve the tamper score, dropping what is left once it falls below one.
+func decayTamperScore(score float64) float64 {
+	if score /= 2; score < 1 {
+		return 0
+	}
+	return score
+}
+
+// Return the tamper score of the proxy, zero when the history does not know it.
+func (history History) TamperScore(proxy string) float64 {
+	if entry, ok := history[proxy]; ok {
+		return entry.TamperScore
+	}
+	return 0
+}
+
+// Return the share of checks that succeeded, or zero when the proxy was never checked.
+func uptimeRatio(successes int, checks int) float64 {
+	if checks == 0 {
+		return 0
+	}
+	return float64(successes) / float64(checks)
+}
+
+// Return the history entries sorted by proxy.
+func (history History) Entries() []HistoryEntry {
+	// Copy the entries out of the map.
+	entries := make([]HistoryEntry, 0, len(history))
+	for _, entry := range history {
+		entries = append(entries, *entry)
+	}
+	// Sort them so the file is stable between runs.
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Proxy < entries[j].Proxy
+	})
+	return entries
+}
+
+// Return every URL in the history, for the plain history file.
+func (history History) URLs() []string {
+	// Create a slice to store the URLs.
+	var urls []string
+	for _, entry := range history {
+		urls = append(urls, entry.URLs...)
+	}
+	// Return the URLs.
+	return urls
+}
+
+// Replace the history store at the path with the entries.
+func (history History) Write(path string) error {
+	// Encode the store.
+	entries := history.Entries()
+	content, err := json.MarshalIndent(historyFile{
+		UpdatedAt: time.Now().UTC().Truncate(time.Second),
+		Count:     len(entries),
+		Proxies:   entries,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Replace the file atomically.
+	return WriteFileAtomically(path, append(content, '\n'))
+}
+
+// Append the value to the slice unless it is already there.
+func appendUniqueString(slice []string, value string) []string {
+	for _, existing := range slice {
+		if existing == value {
+			return slice
+		}
+	}
+	return append(slice, value)
+}
@@ -0,0 +1,165 @@
+package store
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/complexorganizations/proxy-registry/validate"
+)
+
+func TestUpdateHistoryCountsChecksAndSuccesses(t *testing.T) {
+	history := make(History)
+	firstRun := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	secondRun := firstRun.Add(24 * time.Hour)
+	working := validate.Result{Proxy: "203.0.113.10:8080", Protocols: []validate.ProtocolResult{{URL: "http://203.0.113.10:8080"}}}
+
+	history.Update([]string{"203.0.113.10:8080", "203.0.113.20:1080"}, []validate.Result{working}, firstRun)
+	history.Update([]string{"203.0.113.10:8080"}, nil, secondRun)
+
+	entry := history["203.0.113.10:8080"]
+	if entry.Checks != 2 || entry.Successes != 1 || entry.Uptime != 0.5 {
+		t.Fatalf("checks %d, successes %d, uptime %v; want 2, 1, 0.5", entry.Checks, entry.Successes, entry.Uptime)
+	}
+	if !entry.FirstSeen.Equal(firstRun) || !entry.LastSeen.Equal(secondRun) || !entry.LastSuccess.Equal(firstRun) {
+		t.Fatalf("unexpected times: %+v", entry)
+	}
+	if len(entry.URLs) != 1 || entry.URLs[0] != "http://203.0.113.10:8080" {
+		t.Fatalf("urls = %v", entry.URLs)
+	}
+	dead := history["203.0.113.20:1080"]
+	if dead.Checks != 1 || dead.Successes != 0 || dead.Uptime != 0 || !dead.LastSuccess.IsZero() {
+		t.Fatalf("unexpected entry for a dead proxy: %+v", dead)
+	}
+}
+
+func TestUpdateHistoryAccumulatesTamperScores(t *testing.T) {
+	history := make(History)
+	run := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	proxy := "203.0.113.10:8080"
+	tampering := validate.Result{Proxy: proxy, Protocols: []validate.ProtocolResult{{URL: "http://" + proxy}}, Tampering: "judge received the User-Agent \"x\"", TamperScore: 60}
+
+	history.Update([]string{proxy}, []validate.Result{tampering}, run)
+	history.Update([]string{proxy}, []validate.Result{tampering}, run.Add(24*time.Hour))
+
+	entry := history[proxy]
+	if entry.TamperScore != 90 || entry.LastTampering != tampering.Tampering || entry.Successes != 0 || len(entry.URLs) != 0 {
+		t.Fatalf("entry = %+v, want a score of 60/2+60 and no success", entry)
+	}
+	// Clean runs halve the score until nothing is left.
+	for day := 2; day < 10; day++ {
+		history.Update([]string{proxy}, nil, run.Add(time.Duration(day)*24*time.Hour))
+	}
+	if score := history.TamperScore(proxy); score != 0 {
+		t.Fatalf("score = %v after eight clean runs, want 0", score)
+	}
+}
+
+func TestLoadHistorySeedsFromThePlainHistoryFile(t *testing.T) {
+	store := New(t.TempDir())
+	if err := os.WriteFile(store.HistoryFile, []byte("http://203.0.113.10:8080\nsocks5://203.0.113.10:8080\n\nsocks4://203.0.113.20:1080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	history, err := store.LoadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || len(history["203.0.113.10:8080"].URLs) != 2 {
+		t.Fatalf("unexpected seeded history: %v", history)
+	}
+
+	if err := history.Write(store.HistoryStoreFile); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := store.LoadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded) != 2 || reloaded["203.0.113.20:1080"].URLs[0] != "socks4://203.0.113.20:1080" {
+		t.Fatalf("unexpected reloaded history: %v", reloaded)
+	}
+}
+
+func TestWriteListingsKeepsTheSeededEntriesAPartialRunDidNotCheck(t *testing.T) {
+	store := New(t.TempDir())
+	if err := os.WriteFile(store.HistoryFile, []byte("http://203.0.113.10:8080\nhttp://203.0.113.20:8080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	working := validate.Result{Proxy: "203.0.113.10:8080", Protocols: []validate.ProtocolResult{{Scheme: "http", URL: "http://203.0.113.10:8080"}}}
+
+	// A run cut short by the deadline only checked the first proxy.
+	store.WriteListings([]validate.Result{working}, []string{"203.0.113.10:8080"})
+
+	history, err := store.LoadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := history["203.0.113.20:8080"]
+	if !ok || entry.FirstSeen.IsZero() || len(entry.URLs) != 1 {
+		t.Fatalf("history = %v, want the unchecked legacy entry kept with a first-seen time", history)
+	}
+}
+
+func TestPruneHistoryKeepsEntriesWithoutATime(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	history := History{"203.0.113.1:80": {Proxy: "203.0.113.1:80", URLs: []string{"http://203.0.113.1:80"}}}
+	if summary := history.Prune(now, 30, 0); summary.Kept != 1 || len(history) != 1 {
+		t.Fatalf("summary = %+v, want the entry without a time kept", summary)
+	}
+}
+
+func TestLoadHistoryReportsABrokenStore(t *testing.T) {
+	store := New(t.TempDir())
+	if err := os.WriteFile(store.HistoryStoreFile, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.LoadHistory(); err == nil {
+		t.Fatal("expected an error for a broken history store")
+	}
+}
+
+func TestPruneHistoryAppliesTheRetentionRules(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	history := History{
+		"203.0.113.1:80": {Proxy: "203.0.113.1:80", FirstSeen: now.AddDate(0, 0, -90), LastSuccess: now.AddDate(0, 0, -1)},
+		"203.0.113.2:80": {Proxy: "203.0.113.2:80", FirstSeen: now.AddDate(0, 0, -90), LastSuccess: now.AddDate(0, 0, -31)},
+		"203.0.113.3:80": {Proxy: "203.0.113.3:80", FirstSeen: now.AddDate(0, 0, -2)},
+		"203.0.113.4:80": {Proxy: "203.0.113.4:80", FirstSeen: now.AddDate(0, 0, -40)},
+		"203.0.113.5:80": {Proxy: "203.0.113.5:80", FirstSeen: now.AddDate(0, 0, -5), LastSuccess: now.AddDate(0, 0, -5), ConsecutiveFailures: 5},
+	}
+
+	summary := history.Prune(now, 30, 5)
+
+	if summary.Expired != 2 || summary.Failures != 1 || summary.Kept != 2 {
+		t.Fatalf("summary = %+v, want 2 expired, 1 failing, 2 kept", summary)
+	}
+	for _, proxy := range []string{"203.0.113.1:80", "203.0.113.3:80"} {
+		if _, ok := history[proxy]; !ok {
+			t.Errorf("%s was pruned", proxy)
+		}
+	}
+}
+
+func TestPruneHistoryKeepsEverythingWhenDisabled(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	history := History{
+		"203.0.113.1:80": {Proxy: "203.0.113.1:80", ConsecutiveFailures: 100},
+	}
+	if summary := history.Prune(now, 0, 0); summary.Kept != 1 || len(history) != 1 {
+		t.Fatalf("summary = %+v, want everything kept", summary)
+	}
+}
+
+func TestUpdateHistoryResetsConsecutiveFailures(t *testing.T) {
+	history := make(History)
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	history.Update([]string{"203.0.113.1:80"}, nil, now)
+	history.Update([]string{"203.0.113.1:80"}, nil, now)
+	if failures := history["203.0.113.1:80"].ConsecutiveFailures; failures != 2 {
+		t.Fatalf("consecutive failures = %d, want 2", failures)
+	}
+	history.Update([]string{"203.0.113.1:80"}, []validate.Result{{Proxy: "203.0.113.1:80"}}, now)
+	if failures := history["203.0.113.1:80"].ConsecutiveFailures; failures != 0 {
+		t.Fatalf("consecutive failures = %d, want 0 after a success", failures)
+	}
+}
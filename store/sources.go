@@ -0,0 +1,105 @@
+package store
+
+import (
+	"encoding/json" // Encodes and decodes the sources report
+	"fmt"           // Formats the sources report error messages
+	"log"           // Implements logging functionality
+	"os"            // Provides platform-independent OS functions, including file handling
+	"time"          // Provides functionality for measuring and displaying time
+
+	"github.com/complexorganizations/proxy-registry/source"   // The reports of the sources
+	"github.com/complexorganizations/proxy-registry/validate" // The validation results the yields are computed from
+)
+
+// How every source did in one run.
+type SourceRun struct {
+	At      time.Time             `json:"at"`      // When the run was recorded
+	Sources []source.SourceReport `json:"sources"` // One report per fetched source, in the order of the sources file
+}
+
+// The layout of the sources report file.
+type sourcesReportFile struct {
+	UpdatedAt time.Time   `json:"updated_at"` // When the report was written
+	Runs      []SourceRun `json:"runs"`       // The recorded runs, newest first
+}
+
+// Load the runs of the sources report, newest first; a missing report has none.
+func LoadSourceRuns(path string) ([]SourceRun, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored sourcesReportFile
+	if err := json.Unmarshal(content, &stored); err != nil {
+		return nil, fmt.Errorf("reading sources report %s: %w", path, err)
+	}
+	return stored.Runs, nil
+}
+
+// Record how every source did in the run and replace the sources report, keeping the latest runs.
+// Proxies the history does not know count as new, so this must run before WriteListings records the run.
+func (store *Store) WriteSourcesReport(reports []source.SourceReport, results []validate.Result) {
+	if store.SourcesReportFile == "" {
+		return
+	}
+	runs, err := LoadSourceRuns(store.SourcesReportFile)
+	if err != nil {
+		// Start a new report rather than lose this run.
+		log.Println("Error loading sources report:", err)
+	}
+	history, err := store.LoadHistory()
+	if err != nil {
+		log.Println("Error loading history:", err)
+	}
+	// Count the proxies that passed validation per source; tampering proxies do not count.
+	results, _ = validate.SplitTampering(results)
+	passed := make(map[string]int)
+	for _, result := range results {
+		for _, url := range result.Sources {
+			passed[url]++
+		}
+	}
+	// The previous run tells how long a source has gone without a working proxy.
+	previous := make(map[string]*source.SourceReport)
+	if len(runs) > 0 {
+		for index := range runs[0].Sources {
+			previous[runs[0].Sources[index].URL] = &runs[0].Sources[index]
+		}
+	}
+	run := SourceRun{At: time.Now().UTC().Truncate(time.Second), Sources: make([]source.SourceReport, 0, len(reports))}
+	var stale int
+	for _, report := range reports {
+		if history != nil {
+			report.New = 0
+			for _, proxy := range report.Proxies {
+				if _, ok := history[proxy]; !ok {
+					report.New++
+				}
+			}
+		}
+		report.RecordPassed(passed[report.URL], previous[report.URL])
+		if report.ConsecutiveEmptyRuns > 1 {
+			stale++
+		}
+		run.Sources = append(run.Sources, report)
+	}
+	if stale > 0 {
+		log.Printf("%d sources yielded no working proxy for more than one run in a row", stale)
+	}
+	// Keep the newest runs first and drop the oldest beyond the limit.
+	runs = append([]SourceRun{run}, runs...)
+	if store.ReportRuns > 0 && len(runs) > store.ReportRuns {
+		runs = runs[:store.ReportRuns]
+	}
+	content, err := json.MarshalIndent(sourcesReportFile{UpdatedAt: run.At, Runs: runs}, "", "  ")
+	if err != nil {
+		log.Println("Error encoding sources report:", err)
+		return
+	}
+	if err := WriteFileAtomically(store.SourcesReportFile, append(content, '\n')); err != nil {
+		log.Println("Error writing file:", err)
+	}
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/complexorganizations/proxy-registry/source"
+	"github.com/complexorganizations/proxy-registry/validate"
+)
+
+func TestWriteSourcesReportKeepsTheLatestRuns(t *testing.T) {
+	store := New(t.TempDir())
+	store.ReportRuns = 2
+	feed := "https://example.com/http.txt"
+	history := History{"203.0.113.10:8080": {Proxy: "203.0.113.10:8080"}}
+	if err := history.Write(store.HistoryStoreFile); err != nil {
+		t.Fatal(err)
+	}
+	reports := []source.SourceReport{{URL: feed, Status: 200, Proxies: []string{"203.0.113.10:8080", "203.0.113.20:8080", "203.0.113.30:8080", "203.0.113.40:8080"}}}
+	working := []validate.Result{
+		{Proxy: "203.0.113.10:8080", Sources: []string{feed}},
+		{Proxy: "203.0.113.20:8080", Sources: []string{feed}, Tampering: "modified body", TamperScore: 60},
+	}
+
+	store.WriteSourcesReport(reports, working)
+	store.WriteSourcesReport(reports, nil)
+	store.WriteSourcesReport(reports, nil)
+
+	runs, err := LoadSourceRuns(store.SourcesReportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("runs = %+v, want the two latest", runs)
+	}
+	if report := runs[0].Sources[0]; report.Passed != 0 || report.ConsecutiveEmptyRuns != 2 || report.New != 3 {
+		t.Errorf("latest report = %+v, want a second empty run and 3 proxies the history does not know", report)
+	}
+	if report := runs[1].Sources[0]; report.Passed != 0 || report.ConsecutiveEmptyRuns != 1 {
+		t.Errorf("previous report = %+v, want the first empty run", report)
+	}
+}
+
+func TestWriteSourcesReportComputesTheYield(t *testing.T) {
+	store := New(t.TempDir())
+	feed := "https://example.com/http.txt"
+	reports := []source.SourceReport{{URL: feed, Status: 200, Proxies: []string{"203.0.113.10:8080", "203.0.113.20:8080", "203.0.113.30:8080", "203.0.113.40:8080"}}}
+	working := []validate.Result{
+		{Proxy: "203.0.113.10:8080", Sources: []string{feed}},
+		{Proxy: "203.0.113.20:8080", Sources: []string{feed}, Tampering: "modified body", TamperScore: 60},
+	}
+
+	store.WriteSourcesReport(reports, working)
+
+	runs, err := LoadSourceRuns(store.SourcesReportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report := runs[0].Sources[0]; report.Passed != 1 || report.YieldPercent != 25 || report.New != 4 || report.ConsecutiveEmptyRuns != 0 {
+		t.Fatalf("report = %+v, want 1 of 4 proxies passed, the tampering one left out", report)
+	}
+}
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"fmt"  // Formats the statistics
+	"io"   // Provides basic I/O primitives
+	"os"   // Provides platform-independent OS functions, including file handling
+	"sort" // Implements sorting functions
+	"time" // Provides functionality for measuring and displaying time
+
+	"github.com/complexorganizations/proxy-registry/validate" // The results of the published listing
+)
+
+// An uptime at or above this makes a proxy reliable in the statistics.
+const ReliableUptime = 0.9
+
+// A summary of the published listing and the history.
+type Stats struct {
+	Published     int            `json:"published"`      // Number of proxies in the published listing
+	ByScheme      map[string]int `json:"by_scheme"`      // Published proxy URLs per protocol
+	ByAnonymity   map[string]int `json:"by_anonymity"`   // Published proxies per anonymity level
+	ByFamily      map[string]int `json:"by_family"`      // Published proxies per address family
+	Tracked       int            `json:"tracked"`        // Number of proxies in the history
+	EverWorked    int            `json:"ever_worked"`    // Proxies in the history that passed validation at least once
+	Reliable      int            `json:"reliable"`       // Proxies in the history with an uptime of at least 90%
+	AverageUptime float64        `json:"average_uptime"` // Average uptime of the checked proxies in the history
+	LastRun       time.Time      `json:"last_run"`       // Latest time a proxy was seen in the history
+}
+
+// Summarize the results of the published listing and the entries of the history.
+func ComputeStats(results []validate.Result, history History) Stats {
+	// Create a value to store the summary.
+	stats := Stats{
+		Published:   len(results),
+		ByScheme:    make(map[string]int),
+		ByAnonymity: make(map[string]int),
+		ByFamily:    make(map[string]int),
+		Tracked:     len(history),
+	}
+	// Count the published proxies.
+	for _, result := range results {
+		stats.ByAnonymity[result.Anonymity]++
+		// Listings written before the family was recorded leave it empty.
+		if result.Family != "" {
+			stats.ByFamily[result.Family]++
+		}
+		for _, protocol := range result.Protocols {
+			stats.ByScheme[protocol.Scheme]++
+		}
+	}
+	// Summarize the history.
+	var checked int
+	var uptimeSum float64
+	for _, entry := range history {
+		if entry.Successes > 0 {
+			stats.EverWorked++
+		}
+		if entry.Checks > 0 {
+			checked++
+			uptimeSum += entry.Uptime
+			if entry.Uptime >= ReliableUptime {
+				stats.Reliable++
+			}
+		}
+		if entry.LastSeen.After(stats.LastRun) {
+			stats.LastRun = entry.LastSeen
+		}
+	}
+	if checked > 0 {
+		stats.AverageUptime = uptimeSum / float64(checked)
+	}
+	return stats
+}
+
+// Read the published listing and the history and summarize them; missing files count as empty.
+func (store *Store) Stats() (Stats, error) {
+	// Read the published listing.
+	results, err := ReadListing(store.HostsJSONFile)
+	if err != nil && !os.IsNotExist(err) {
+		return Stats{}, err
+	}
+	// Read the history.
+	history, err := store.LoadHistory()
+	if err != nil {
+		return Stats{}, err
+	}
+	return ComputeStats(results, history), nil
+}
+
+// Write the statistics as readable text.
+func (stats Stats) WriteText(writer io.Writer) {
+	fmt.Fprintf(writer, "Published proxies:  %d\n", stats.Published)
+	for _, key := range sortedKeys(stats.ByScheme) {
+		fmt.Fprintf(writer, "  %-17s %d\n", key+":", stats.ByScheme[key])
+	}
+	for _, key := range sortedKeys(stats.ByAnonymity) {
+		fmt.Fprintf(writer, "  %-17s %d\n", key+":", stats.ByAnonymity[key])
+	}
+	for _, key := range sortedKeys(stats.ByFamily) {
+		fmt.Fprintf(writer, "  %-17s %d\n", key+":", stats.ByFamily[key])
+	}
+	fmt.Fprintf(writer, "Tracked in history: %d\n", stats.Tracked)
+	fmt.Fprintf(writer, "Ever worked:        %d\n", stats.EverWorked)
+	fmt.Fprintf(writer, "Reliable (>= %.0f%%): %d\n", ReliableUptime*100, stats.Reliable)
+	fmt.Fprintf(writer, "Average uptime:     %.1f%%\n", stats.AverageUptime*100)
+	if !stats.LastRun.IsZero() {
+		fmt.Fprintf(writer, "Last run:           %s\n", stats.LastRun.Format(time.RFC3339))
+	}
+}
+
+// Return the keys of the map in sorted order.
+func sortedKeys(values map[string]int) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
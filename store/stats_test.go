@@ -0,0 +1,32 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/complexorganizations/proxy-registry/validate"
+)
+
+func TestComputeStats(t *testing.T) {
+	lastRun := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	results := []validate.Result{
+		{Proxy: "203.0.113.10:8080", Protocols: []validate.ProtocolResult{{Scheme: "http"}, {Scheme: "socks5"}}, Anonymity: validate.AnonymityElite, Family: "ipv4"},
+	}
+	history := History{
+		"203.0.113.10:8080": {Checks: 10, Successes: 10, Uptime: 1, LastSeen: lastRun},
+		"203.0.113.20:1080": {Checks: 10, Successes: 2, Uptime: 0.2, LastSeen: lastRun.Add(-time.Hour)},
+		"203.0.113.30:1080": {Checks: 4, Uptime: 0},
+	}
+
+	stats := ComputeStats(results, history)
+
+	if stats.Published != 1 || stats.ByScheme["socks5"] != 1 || stats.ByAnonymity[validate.AnonymityElite] != 1 || stats.ByFamily["ipv4"] != 1 {
+		t.Errorf("unexpected listing stats: %+v", stats)
+	}
+	if stats.Tracked != 3 || stats.EverWorked != 2 || stats.Reliable != 1 || !stats.LastRun.Equal(lastRun) {
+		t.Errorf("unexpected history stats: %+v", stats)
+	}
+	if stats.AverageUptime < 0.39 || stats.AverageUptime > 0.41 {
+		t.Errorf("average uptime = %v, want 0.4", stats.AverageUptime)
+	}
+}
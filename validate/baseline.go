@@ -0,0 +1,144 @@
+package validate
+
+import (
+	"context"     // Cancels the direct requests when the run is cancelled
+	"crypto/tls"  // Reads the verified certificate chains
+	"crypto/x509" // Holds the certificate authorities trusted for the targets
+	"fmt"         // Formats the baseline error messages
+	"io"          // Reads the direct responses
+	"log"         // Implements logging functionality
+	"net"         // Tells addresses from hostnames
+	"net/http"    // Provides HTTP client and server implementations
+	"net/url"     // Reads the host of the targets
+	"slices"      // Looks up the hosts of the baseline
+	"strings"     // Splits the hostnames into labels
+	"time"        // Provides functionality for measuring and displaying time
+)
+
+// What a validation target looks like without a proxy in between.
+type TargetBaseline struct {
+	Redirects []string // Hosts the target redirects to, in order
+}
+
+// The baselines of the validation targets, by target as configured, which the requests through every proxy are compared to.
+type Baseline map[string]TargetBaseline
+
+// Request every target directly and record where it redirects to.
+// A target that cannot be reached directly has no baseline, so its redirects are not compared.
+// A target whose certificate or body fails the checks even without a proxy returns an error, since every proxy would
+// otherwise be flagged as tampering with it. The plain HTTP versions that forward-only proxies fetch are learned too.
+func LearnBaseline(ctx context.Context, targets []string, roots *x509.CertPool) (Baseline, error) {
+	baseline := make(Baseline)
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+		Timeout:   time.Second * 30,
+	}
+	defer client.CloseIdleConnections()
+	for _, target := range targets {
+		learned, err := learnTargetBaseline(ctx, client, target)
+		if IsTampering(err) {
+			return nil, fmt.Errorf("target %s fails its checks without a proxy: %s", target, tamperingReason(err))
+		}
+		if err != nil {
+			log.Println("Error learning the baseline of", target+":", err)
+			continue
+		}
+		baseline[target] = learned
+	}
+	// Forward-only proxies fetch the plain HTTP version of the HTTPS targets, which needs a baseline of its own.
+	// Only the targets as configured must pass without a proxy, so a plain HTTP version that fails is only logged.
+	for _, target := range forwardTargets(targets) {
+		if slices.Contains(targets, target) {
+			continue
+		}
+		learned, err := learnTargetBaseline(ctx, client, target)
+		if err != nil {
+			log.Println("Error learning the baseline of", target+":", err)
+			continue
+		}
+		baseline[target] = learned
+	}
+	return baseline, nil
+}
+
+// Request the target directly, check its certificate and body like through a proxy, and record its redirects.
+func learnTargetBaseline(ctx context.Context, client *http.Client, target string) (TargetBaseline, error) {
+	requestURL, expectation := prepareTarget(target)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return TargetBaseline{}, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return TargetBaseline{}, classifyRequestError(err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxTargetBodySize))
+	if err != nil {
+		return TargetBaseline{}, err
+	}
+	if err := expectation.check(body); err != nil {
+		return TargetBaseline{}, err
+	}
+	return TargetBaseline{Redirects: redirectHosts(response)}, nil
+}
+
+// Return the hosts the request of the response was redirected to, in order.
+func redirectHosts(response *http.Response) []string {
+	var hosts []string
+	for request := response.Request; request != nil && request.Response != nil; request = request.Response.Request {
+		hosts = append([]string{request.URL.Host}, hosts...)
+	}
+	return hosts
+}
+
+// Compare what the proxy returned for every target with the baseline, reporting a redirect to a host the target does
+// not redirect to, outside the registrable domain of the target, as tampering. A certificate is not compared: one that
+// verifies against the trusted roots is not interception, even when an edge in another region serves another chain,
+// and a redirect within the domain of the target, such as a regional site, is not either. Targets without a baseline
+// are not compared.
+func (baseline Baseline) inspect(protocol ProtocolResult) error {
+	for _, checked := range protocol.Targets {
+		expected, ok := baseline[checked.Target]
+		if !ok {
+			continue
+		}
+		for _, host := range checked.redirects {
+			if !slices.Contains(expected.Redirects, host) && !sameSite(host, checked.Target) {
+				return tamperingError(SignalForeignRedirect, "%s: redirected to %s, which the target does not redirect to", checked.Target, host)
+			}
+		}
+	}
+	return nil
+}
+
+// Report whether the host, with or without a port, lies within the registrable domain of the target URL.
+// A target named by its address has no domain, so only the redirects of its baseline are expected.
+func sameSite(host string, target string) bool {
+	targetURL, err := url.Parse(target)
+	if err != nil || net.ParseIP(targetURL.Hostname()) != nil {
+		return false
+	}
+	domain := registrableDomain(targetURL.Hostname())
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	return domain != "" && (host == domain || strings.HasSuffix(host, "."+domain))
+}
+
+// Return the domain that was registered for the hostname, such as example.com for www.example.com, taking one more
+// label under the short second level domains of country codes, such as example.co.uk. Without the public suffix list
+// this is an approximation, which only ever widens a redirect check to a sibling under the same suffix.
+func registrableDomain(hostname string) string {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	labels := strings.Split(hostname, ".")
+	keep := 2
+	if count := len(labels); count >= 3 && len(labels[count-1]) == 2 && len(labels[count-2]) <= 3 {
+		keep = 3
+	}
+	if len(labels) <= keep {
+		return hostname
+	}
+	return strings.Join(labels[len(labels)-keep:], ".")
+}
@@ -0,0 +1,115 @@
+package validate
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/complexorganizations/proxy-registry/source"
+)
+
+func TestLearnBaselineRecordsRedirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/start" {
+			http.Redirect(writer, request, "/end", http.StatusFound)
+			return
+		}
+		io.WriteString(writer, "ok")
+	}))
+	defer target.Close()
+
+	baseline, err := LearnBaseline(context.Background(), []string{target.URL + "/start", "http://127.0.0.1:1/"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host := strings.TrimPrefix(target.URL, "http://")
+	if learned, ok := baseline[target.URL+"/start"]; !ok || len(learned.Redirects) != 1 || learned.Redirects[0] != host {
+		t.Fatalf("baseline = %+v, want one redirect to %s", baseline, host)
+	}
+	if _, ok := baseline["http://127.0.0.1:1/"]; ok {
+		t.Fatal("an unreachable target should have no baseline")
+	}
+}
+
+func TestLearnBaselineRejectsTargetsThatFailWithoutAProxy(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		io.WriteString(writer, "not the nonce")
+	}))
+	defer target.Close()
+
+	// Without the authority of the target its certificate does not verify.
+	if _, err := LearnBaseline(context.Background(), []string{target.URL + "/"}, nil); err == nil || !strings.Contains(err.Error(), target.URL) {
+		t.Fatalf("err = %v, want the untrusted certificate reported", err)
+	}
+	// A target that does not echo the nonce fails for every proxy as well.
+	if _, err := LearnBaseline(context.Background(), []string{target.URL + "/?nonce=" + NoncePlaceholder}, serverRootCAs(target)); err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Fatalf("err = %v, want the missing nonce reported", err)
+	}
+	if _, err := LearnBaseline(context.Background(), []string{target.URL + "/"}, serverRootCAs(target)); err != nil {
+		t.Fatalf("err = %v, want a trusted target accepted", err)
+	}
+}
+
+func TestBaselineInspect(t *testing.T) {
+	baseline := Baseline{
+		"https://example.com/":            {Redirects: []string{"www.example.com"}},
+		"https://shop.example.co.uk/":     {},
+		"http://203.0.113.10:8080/target": {},
+	}
+	tests := []struct {
+		name    string
+		checked TargetResult
+		want    string
+	}{
+		{"same redirects", TargetResult{Target: "https://example.com/", redirects: []string{"www.example.com"}}, ""},
+		{"redirect elsewhere", TargetResult{Target: "https://example.com/", redirects: []string{"login.example.net"}}, SignalForeignRedirect},
+		{"regional redirect within the domain", TargetResult{Target: "https://example.com/", redirects: []string{"eu.example.com:443"}}, ""},
+		{"redirect to a lookalike", TargetResult{Target: "https://example.com/", redirects: []string{"example.com.example.net"}}, SignalForeignRedirect},
+		{"redirect within a country code domain", TargetResult{Target: "https://shop.example.co.uk/", redirects: []string{"www.example.co.uk"}}, ""},
+		{"redirect to another country code domain", TargetResult{Target: "https://shop.example.co.uk/", redirects: []string{"other.co.uk"}}, SignalForeignRedirect},
+		{"redirect away from an address", TargetResult{Target: "http://203.0.113.10:8080/target", redirects: []string{"203.0.113.11:8080"}}, SignalForeignRedirect},
+		{"target without a baseline", TargetResult{Target: "https://example.org/", redirects: []string{"anywhere.example"}}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := baseline.inspect(ProtocolResult{Targets: []TargetResult{test.checked}})
+			if signal := tamperingSignal(err); signal != test.want {
+				t.Fatalf("err = %v, want signal %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckFlagsAProxyThatRedirectsElsewhere(t *testing.T) {
+	target := startTargetServer(t)
+	phishing := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		io.WriteString(writer, "please log in")
+	}))
+	defer phishing.Close()
+	// A proxy that sends every request for the target to the phishing page instead.
+	honest := httpProxyStubHandler(true, nil)
+	proxy := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodGet && request.URL.Host == strings.TrimPrefix(target.URL, "http://") {
+			http.Redirect(writer, request, phishing.URL, http.StatusFound)
+			return
+		}
+		honest.ServeHTTP(writer, request)
+	}))
+	defer proxy.Close()
+	checker := newTestChecker(target.URL)
+	baseline, err := LearnBaseline(context.Background(), checker.Targets, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker.Baseline = baseline
+
+	result, ok := checker.Check(context.Background(), source.Proxy{Address: strings.TrimPrefix(proxy.URL, "http://"), Protocol: "http"})
+
+	if !ok || len(result.TamperSignals) != 1 || result.TamperSignals[0] != SignalForeignRedirect || result.TamperScore != signalScores[SignalForeignRedirect] {
+		t.Fatalf("ok = %v, result = %+v, want a foreign redirect", ok, result)
+	}
+}
@@ -0,0 +1,401 @@
+package validate
+
+import (
+	"bufio"       // Reads the HTTP responses from the raw connections
+	"context"     // Carries the deadline of the SOCKS4 request building
+	"crypto/tls"  // Performs the TLS handshakes with the proxy and the target
+	"crypto/x509" // Verifies the certificate of the target for the report
+	"fmt"         // Formats the report and the error messages
+	"io"          // Provides basic I/O primitives
+	"net"         // Provides networking utilities
+	"net/http"    // Provides HTTP client and server implementations
+	"net/url"     // Handles URL parsing and manipulation
+	"sort"        // Implements sorting functions
+	"strconv"     // Converts the destination port to a number
+	"strings"     // Provides string manipulation utilities
+	"time"        // Provides functionality for measuring and displaying time
+
+	"github.com/complexorganizations/proxy-registry/source" // The proxy to diagnose
+)
+
+// Longest a single diagnosis of one target may take.
+const diagnosticTimeout = time.Second * 30
+
+// Protocols the check command tries, in order.
+var diagnosticProtocols = []string{"http://", "https://", "socks4://", "socks4a://", "socks5://"}
+
+// One step of a diagnosis, such as the TCP connect or the TLS handshake with the target.
+type diagnosticStage struct {
+	name     string        // What was attempted
+	detail   string        // What was observed when the step worked
+	err      error         // Why the step failed, nil when it worked
+	duration time.Duration // How long the step took
+}
+
+// Everything observed while requesting one target through the proxy.
+type targetDiagnosis struct {
+	target    string            // URL requested through the proxy
+	expect    targetExpectation // What the body must hold, as asked for by the target URL
+	stages    []diagnosticStage // The steps in the order they ran
+	firstByte time.Duration     // Time from sending the request to the response headers
+	total     time.Duration     // Time from sending the request to the end of the body
+	headers   http.Header       // Response headers of the target
+}
+
+// Return the stage that failed, or nil when every stage worked.
+func (diagnosis targetDiagnosis) failedStage() *diagnosticStage {
+	for index := range diagnosis.stages {
+		if diagnosis.stages[index].err != nil {
+			return &diagnosis.stages[index]
+		}
+	}
+	return nil
+}
+
+// Run a step, record it as a stage and report whether it worked.
+func (diagnosis *targetDiagnosis) run(name string, step func() (string, error)) bool {
+	start := time.Now()
+	detail, err := step()
+	diagnosis.stages = append(diagnosis.stages, diagnosticStage{name: name, detail: detail, err: err, duration: time.Since(start)})
+	return err == nil
+}
+
+// A connection that reads through a buffered reader, so bytes buffered while reading a proxy reply are not lost.
+type bufferedConn struct {
+	net.Conn               // The underlying connection, used for writing
+	reader   *bufio.Reader // Reader holding any byte read ahead
+}
+
+// Read from the buffered reader.
+func (conn bufferedConn) Read(buffer []byte) (int, error) {
+	return conn.reader.Read(buffer)
+}
+
+// Request the target through the proxy with the given protocol, recording every stage on the way.
+// The user holds the credentials of the proxy and is nil when it needs none.
+func diagnoseProxy(ctx context.Context, proxy string, user *url.Userinfo, protocol string, target string) targetDiagnosis {
+	// Create a value to store the observations.
+	diagnosis := targetDiagnosis{target: target}
+	requestURL, expectation := prepareTarget(target)
+	diagnosis.expect = expectation
+	targetURL, err := url.Parse(requestURL)
+	if err != nil {
+		diagnosis.run("parse target", func() (string, error) { return "", err })
+		return diagnosis
+	}
+	targetAddress := targetHostPort(targetURL)
+	// Open the TCP connection to the proxy.
+	var conn net.Conn
+	if !diagnosis.run("TCP connect", func() (string, error) {
+		dialer := &net.Dialer{Timeout: diagnosticTimeout}
+		dialed, err := dialer.DialContext(ctx, "tcp", proxy)
+		if err != nil {
+			return "", err
+		}
+		conn = closeOnCancel(ctx, dialed)
+		return "connected to " + dialed.RemoteAddr().String(), nil
+	}) {
+		return diagnosis
+	}
+	// Close whatever the connection ends up wrapped in.
+	defer func() { conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(diagnosticTimeout))
+	// Open the tunnel to the target with the protocol of the proxy.
+	switch protocol {
+	case "https://":
+		// An HTTPS proxy expects TLS on its own port before anything else.
+		if !diagnosis.run("TLS to proxy", func() (string, error) {
+			host, _ := source.SplitHostPort(proxy)
+			tlsConn := tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				return "", err
+			}
+			conn = tlsConn
+			return tls.VersionName(tlsConn.ConnectionState().Version), nil
+		}) {
+			return diagnosis
+		}
+		fallthrough
+	case "http://":
+		// A plain HTTP target is fetched by the proxy itself, anything else goes through a CONNECT tunnel.
+		if targetURL.Scheme == "http" {
+			return diagnoseRequest(diagnosis, conn, targetURL, user, true)
+		}
+		if !diagnosis.run("CONNECT", func() (string, error) {
+			if _, err := fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n%s\r\n", targetAddress, targetAddress, proxyAuthorizationHeader(user)); err != nil {
+				return "", err
+			}
+			reader := bufio.NewReader(conn)
+			response, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+			if err != nil {
+				return "", err
+			}
+			response.Body.Close()
+			if response.StatusCode < 200 || response.StatusCode >= 300 {
+				return "", fmt.Errorf("proxy answered %s", response.Status)
+			}
+			conn = bufferedConn{Conn: conn, reader: reader}
+			return response.Proto + " " + response.Status, nil
+		}) {
+			return diagnosis
+		}
+	case "socks4://", "socks4a://":
+		if !diagnosis.run("SOCKS4 handshake", func() (string, error) {
+			proxyURL, err := url.Parse(protocol + proxy)
+			if err != nil {
+				return "", err
+			}
+			proxyURL.User = user
+			_, portText, _ := net.SplitHostPort(targetAddress)
+			port, err := strconv.ParseUint(portText, 10, 16)
+			if err != nil {
+				return "", err
+			}
+			request, err := newSOCKS4Dialer(proxyURL).buildRequest(ctx, targetURL.Hostname(), uint16(port))
+			if err != nil {
+				return "", err
+			}
+			if err := socks4Handshake(conn, request); err != nil {
+				return "", err
+			}
+			return "request granted", nil
+		}) {
+			return diagnosis
+		}
+	case "socks5://":
+		if !diagnosis.run("SOCKS5 handshake", func() (string, error) {
+			if err := socks5Handshake(conn, targetAddress, user); err != nil {
+				return "", err
+			}
+			return "request granted", nil
+		}) {
+			return diagnosis
+		}
+	default:
+		diagnosis.run("protocol", func() (string, error) { return "", fmt.Errorf("unsupported protocol %q", protocol) })
+		return diagnosis
+	}
+	// Secure the tunnel to an HTTPS target, as the validator does.
+	if targetURL.Scheme == "https" {
+		if !diagnosis.run("TLS to target", func() (string, error) {
+			tlsConn := tls.Client(conn, &tls.Config{ServerName: targetURL.Hostname(), InsecureSkipVerify: true})
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				return "", err
+			}
+			conn = tlsConn
+			return describeTLSState(tlsConn.ConnectionState(), rootCAsFrom(ctx))
+		}) {
+			return diagnosis
+		}
+	}
+	// Request the page through the tunnel.
+	return diagnoseRequest(diagnosis, conn, targetURL, nil, false)
+}
+
+// Send a GET request for the target over the connection and record the status, the timings and the headers.
+// A forwarded request is sent to an HTTP proxy in absolute form, with the credentials of the proxy.
+func diagnoseRequest(diagnosis targetDiagnosis, conn net.Conn, targetURL *url.URL, user *url.Userinfo, forwarded bool) targetDiagnosis {
+	requestTarget := targetURL.RequestURI()
+	proxyAuthorization := ""
+	if forwarded {
+		requestTarget = targetURL.String()
+		proxyAuthorization = proxyAuthorizationHeader(user)
+	}
+	start := time.Now()
+	var response *http.Response
+	if !diagnosis.run("HTTP request", func() (string, error) {
+		if _, err := fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUser-Agent: proxy-registry\r\nConnection: close\r\n%s\r\n", requestTarget, targetURL.Host, proxyAuthorization); err != nil {
+			return "", err
+		}
+		var err error
+		response, err = http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			return "", err
+		}
+		diagnosis.firstByte = time.Since(start)
+		return "response received", nil
+	}) {
+		return diagnosis
+	}
+	defer response.Body.Close()
+	diagnosis.headers = response.Header
+	// The validator accepts nothing but 200, whether the request was tunneled or forwarded.
+	if !diagnosis.run("status code", func() (string, error) {
+		if response.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("target answered %s", response.Status)
+		}
+		return response.Proto + " " + response.Status, nil
+	}) {
+		return diagnosis
+	}
+	// Read the body, as the validator does, to measure the total time.
+	diagnosis.run("response body", func() (string, error) {
+		body, err := io.ReadAll(io.LimitReader(response.Body, maxTargetBodySize))
+		diagnosis.total = time.Since(start)
+		if err != nil {
+			return "", err
+		}
+		if err := diagnosis.expect.check(body); err != nil {
+			return "", err
+		}
+		if checks := diagnosis.expect.String(); checks != "" {
+			return fmt.Sprintf("%d bytes, %s", len(body), checks), nil
+		}
+		return fmt.Sprintf("%d bytes", len(body)), nil
+	})
+	return diagnosis
+}
+
+// Describe the negotiated TLS connection once the certificate of the target verifies against the roots, or the system
+// ones when nil. The handshake itself accepts any certificate so the report can say which one was presented; one that
+// does not verify fails the stage as tampering, as it fails the validation.
+func describeTLSState(state tls.ConnectionState, roots *x509.CertPool) (string, error) {
+	description := tls.VersionName(state.Version)
+	if len(state.PeerCertificates) == 0 {
+		return "", tamperingError(SignalUntrustedCertificate, "%s, no certificate", description)
+	}
+	// Verify the chain the way a browser would.
+	certificate := state.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range state.PeerCertificates[1:] {
+		intermediates.AddCert(intermediate)
+	}
+	if _, err := certificate.Verify(x509.VerifyOptions{DNSName: state.ServerName, Roots: roots, Intermediates: intermediates}); err != nil {
+		return "", certificateTampering(certificate, err)
+	}
+	return description + ", certificate for " + certificateName(certificate) + " verified", nil
+}
+
+// Write the stages of a target diagnosis and, when every stage worked, the timings and the response headers.
+func writeTargetDiagnosis(writer io.Writer, diagnosis targetDiagnosis) {
+	fmt.Fprintf(writer, "  %s\n", diagnosis.target)
+	for _, stage := range diagnosis.stages {
+		if stage.err != nil {
+			fmt.Fprintf(writer, "    FAIL %-17s %6d ms  %v\n", stage.name, stage.duration.Milliseconds(), stage.err)
+			continue
+		}
+		fmt.Fprintf(writer, "    ok   %-17s %6d ms  %s\n", stage.name, stage.duration.Milliseconds(), stage.detail)
+	}
+	if failed := diagnosis.failedStage(); failed != nil {
+		if signal := tamperingSignal(failed.err); signal != "" {
+			fmt.Fprintf(writer, "    result: failed at %s, tampering signal %s\n", failed.name, signal)
+			return
+		}
+		fmt.Fprintf(writer, "    result: failed at %s\n", failed.name)
+		return
+	}
+	fmt.Fprintf(writer, "    latency: first byte %d ms, total %d ms\n", diagnosis.firstByte.Milliseconds(), diagnosis.total.Milliseconds())
+	fmt.Fprintln(writer, "    response headers:")
+	names := make([]string, 0, len(diagnosis.headers))
+	for name := range diagnosis.headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(writer, "      %s: %s\n", name, strings.Join(diagnosis.headers[name], ", "))
+	}
+}
+
+// Diagnose the proxy with one protocol against every validation target, write the report and return the first failure.
+// Like the validator, an HTTP proxy that cannot tunnel still passes when it forwards plain HTTP.
+func (checker *Checker) checkProxyProtocol(ctx context.Context, writer io.Writer, proxy source.Proxy, protocol string) *diagnosticStage {
+	fmt.Fprintln(writer, protocol+proxy.Address)
+	var failure *diagnosticStage
+	for _, target := range checker.Targets {
+		diagnosis := diagnoseProxy(ctx, proxy.Address, proxy.User, protocol, target)
+		writeTargetDiagnosis(writer, diagnosis)
+		if failed := diagnosis.failedStage(); failed != nil && failure == nil {
+			failure = failed
+		}
+	}
+	// Give a proxy without CONNECT support the same second chance as the validator: every forward target must pass.
+	if failure != nil && failure.name == "CONNECT" {
+		fmt.Fprintln(writer, "  CONNECT failed, checking whether the proxy forwards plain HTTP instead")
+		failure = nil
+		for _, target := range forwardTargets(checker.Targets) {
+			diagnosis := diagnoseProxy(ctx, proxy.Address, proxy.User, protocol, target)
+			writeTargetDiagnosis(writer, diagnosis)
+			if failed := diagnosis.failedStage(); failed != nil && failure == nil {
+				failure = failed
+			}
+		}
+	}
+	if failure == nil {
+		fmt.Fprintln(writer, "  result: passed")
+	}
+	fmt.Fprintln(writer)
+	return failure
+}
+
+// Diagnose the proxy with every protocol, or only the one it carries, and write a step by step report.
+// The proxy is then validated exactly as the pipeline does, with the baseline, the judge and every tampering signal,
+// and the verdict is written with the signal that fired, if any.
+// It returns an error naming where every protocol failed when none of them works, or why the validation rejected it.
+// Cancelling the context stops the report at the stage in progress.
+func (checker *Checker) Report(ctx context.Context, writer io.Writer, proxy source.Proxy) error {
+	// Trust the same certificate authorities as the validation.
+	ctx = withRootCAs(ctx, checker.RootCAs)
+	// The scheme given with the proxy narrows the check to that protocol.
+	protocols := diagnosticProtocols
+	if proxy.Protocol != "" {
+		protocols = []string{proxy.Protocol + "://"}
+	}
+	if proxy.User != nil {
+		fmt.Fprintf(writer, "Proxy %s, authenticating as %s\n\n", proxy.Address, proxy.User.Username())
+	} else {
+		fmt.Fprintf(writer, "Proxy %s\n\n", proxy.Address)
+	}
+	// Diagnose every protocol, remembering where the failing ones stopped.
+	var failures []string
+	for _, protocol := range protocols {
+		if failed := checker.checkProxyProtocol(ctx, writer, proxy, protocol); failed != nil {
+			failures = append(failures, fmt.Sprintf("%s failed at %s: %v", schemeName(protocol), failed.name, failed.err))
+		}
+	}
+	// A cancelled report has nothing reliable to conclude.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// Validate the proxy the way the pipeline does, so the verdict is the one the listings would show;
+	// a protocol given with the proxy narrows the validation to it as well.
+	validation := checker
+	if hinted, ok := hintValidators[proxy.Protocol]; ok {
+		narrowed := *checker
+		narrowed.Validators = []Validator{hinted}
+		validation = &narrowed
+	}
+	result, recorded := validation.Check(ctx, proxy)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return writeVerdict(writer, result, recorded, failures)
+}
+
+// Write what the validation concluded about the proxy and return an error unless it passed.
+func writeVerdict(writer io.Writer, result Result, recorded bool, failures []string) error {
+	switch {
+	case result.Tampered():
+		fmt.Fprintf(writer, "Verdict: tampering, listed in hosts-tampering\n")
+		fmt.Fprintf(writer, "Tampering: %s\n", result.Tampering)
+		fmt.Fprintf(writer, "Signals: %s (score %d)\n", strings.Join(result.TamperSignals, ", "), result.TamperScore)
+		return fmt.Errorf("%s was caught tampering: %s", result.Proxy, result.Tampering)
+	case !recorded && len(failures) > 0:
+		fmt.Fprintf(writer, "Verdict: failed\n")
+		return fmt.Errorf("%s failed with every protocol: %s", result.Proxy, strings.Join(failures, "; "))
+	case !recorded:
+		fmt.Fprintf(writer, "Verdict: failed\n")
+		return fmt.Errorf("%s failed the validation, for example by being slower than the latency limit", result.Proxy)
+	}
+	working := make([]string, 0, len(result.Protocols))
+	for _, protocol := range result.Protocols {
+		working = append(working, protocol.URL)
+	}
+	fmt.Fprintf(writer, "Verdict: passed\n")
+	fmt.Fprintf(writer, "Working: %s\n", strings.Join(working, " "))
+	fmt.Fprintf(writer, "Anonymity: %s\n", result.Anonymity)
+	fmt.Fprintf(writer, "Latency: %d ms\n", result.LatencyMS)
+	if result.Throughput > 0 {
+		fmt.Fprintf(writer, "Throughput: %d bytes/s\n", result.Throughput)
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package validate
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/complexorganizations/proxy-registry/source"
+)
+
+// Start a SOCKS5 server without authentication that answers every CONNECT with the reply code.
+func startSOCKS5Stub(t *testing.T, reply byte) string {
+	t.Helper()
+	return startAuthenticatingSOCKS5Stub(t, reply, nil)
+}
+
+// Start a SOCKS5 server that requires the username/password method when the user is not nil.
+func startAuthenticatingSOCKS5Stub(t *testing.T, reply byte, user *url.Userinfo) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serveSOCKS5Stub(t, listener, reply, user)
+}
+
+// Serve the SOCKS5 stub on the listener and return its address.
+func serveSOCKS5Stub(t *testing.T, listener net.Listener, reply byte, user *url.Userinfo) string {
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handleSOCKS5Stub(conn, reply, user)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func handleSOCKS5Stub(conn net.Conn, reply byte, user *url.Userinfo) {
+	defer conn.Close()
+	greeting := make([]byte, 2)
+	if _, err := io.ReadFull(conn, greeting); err != nil {
+		return
+	}
+	methods := make([]byte, greeting[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	if user == nil {
+		conn.Write([]byte{socks5Version, socks5NoAuth})
+	} else if !authenticateSOCKS5Stub(conn, methods, user) {
+		return
+	}
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	var host string
+	switch header[3] {
+	case socks5AddressIPv4:
+		address := make([]byte, net.IPv4len)
+		io.ReadFull(conn, address)
+		host = net.IP(address).String()
+	case socks5AddressIPv6:
+		address := make([]byte, net.IPv6len)
+		io.ReadFull(conn, address)
+		host = net.IP(address).String()
+	case socks5AddressDomain:
+		length := make([]byte, 1)
+		io.ReadFull(conn, length)
+		name := make([]byte, length[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return
+	}
+	if reply != socks5Succeeded {
+		conn.Write([]byte{socks5Version, reply, 0, socks5AddressIPv4, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		conn.Write([]byte{socks5Version, 0x05, 0, socks5AddressIPv4, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	conn.Write([]byte{socks5Version, socks5Succeeded, 0, socks5AddressIPv4, 127, 0, 0, 1, 0, 0})
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+// Run the username/password method and report whether the client sent the expected credentials.
+func authenticateSOCKS5Stub(conn net.Conn, methods []byte, user *url.Userinfo) bool {
+	if !bytes.Contains(methods, []byte{socks5UserPass}) {
+		conn.Write([]byte{socks5Version, socks5NoAcceptable})
+		return false
+	}
+	conn.Write([]byte{socks5Version, socks5UserPass})
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return false
+	}
+	username := make([]byte, header[1])
+	io.ReadFull(conn, username)
+	length := make([]byte, 1)
+	io.ReadFull(conn, length)
+	password := make([]byte, length[0])
+	io.ReadFull(conn, password)
+	wantPassword, _ := user.Password()
+	if string(username) != user.Username() || string(password) != wantPassword {
+		conn.Write([]byte{socks5UserPassVer, 1})
+		return false
+	}
+	conn.Write([]byte{socks5UserPassVer, 0})
+	return true
+}
+
+// Return the names of the stages of the diagnosis.
+func stageNames(diagnosis targetDiagnosis) string {
+	var names []string
+	for _, stage := range diagnosis.stages {
+		names = append(names, stage.name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestDiagnoseProxyThroughAConnectTunnel(t *testing.T) {
+	target := httptest.NewTLSServer(startTargetServer(t).Config.Handler)
+	defer target.Close()
+	proxy := startHTTPProxyStub(t, false, true)
+
+	diagnosis := diagnoseProxy(withRootCAs(context.Background(), serverRootCAs(target)), proxy, nil, "http://", target.URL)
+
+	if failed := diagnosis.failedStage(); failed != nil {
+		t.Fatalf("stage %s failed: %v", failed.name, failed.err)
+	}
+	if names := stageNames(diagnosis); names != "TCP connect,CONNECT,TLS to target,HTTP request,status code,response body" {
+		t.Fatalf("stages = %s", names)
+	}
+	if diagnosis.headers.Get("Content-Type") == "" {
+		t.Error("response headers were not recorded")
+	}
+	// Without trusting the test certificate the target looks intercepted.
+	failed := diagnoseProxy(context.Background(), proxy, nil, "http://", target.URL).failedStage()
+	if failed == nil || failed.name != "TLS to target" || !IsTampering(failed.err) {
+		t.Fatalf("failed stage = %+v, want TLS to target failing as tampering", failed)
+	}
+}
+
+func TestDiagnoseProxyReportsARefusedConnect(t *testing.T) {
+	target := httptest.NewTLSServer(startTargetServer(t).Config.Handler)
+	defer target.Close()
+	proxy := startHTTPProxyStub(t, false, false)
+
+	failed := diagnoseProxy(context.Background(), proxy, nil, "http://", target.URL).failedStage()
+
+	if failed == nil || failed.name != "CONNECT" || !strings.Contains(failed.err.Error(), "405") {
+		t.Fatalf("failed stage = %+v, want CONNECT with the 405 status", failed)
+	}
+}
+
+func TestDiagnoseProxyThroughAnHTTPSProxy(t *testing.T) {
+	target := startTargetServer(t)
+	proxy := startHTTPProxyStub(t, true, true)
+
+	diagnosis := diagnoseProxy(context.Background(), proxy, nil, "https://", target.URL)
+
+	if failed := diagnosis.failedStage(); failed != nil {
+		t.Fatalf("stage %s failed: %v", failed.name, failed.err)
+	}
+	if names := stageNames(diagnosis); !strings.HasPrefix(names, "TCP connect,TLS to proxy,HTTP request") {
+		t.Fatalf("stages = %s", names)
+	}
+}
+
+func TestDiagnoseProxyThroughSOCKS(t *testing.T) {
+	target := startTargetServer(t)
+	tests := []struct {
+		name, protocol, proxy string
+	}{
+		{"socks4", "socks4://", startSOCKS4Stub(t, socks4Granted).address()},
+		{"socks5", "socks5://", startSOCKS5Stub(t, socks5Succeeded)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diagnosis := diagnoseProxy(context.Background(), test.proxy, nil, test.protocol, target.URL)
+			if failed := diagnosis.failedStage(); failed != nil {
+				t.Fatalf("stage %s failed: %v", failed.name, failed.err)
+			}
+		})
+	}
+}
+
+func TestDiagnoseProxyNamesTheFailingStage(t *testing.T) {
+	target := startTargetServer(t)
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddress := closed.Addr().String()
+	closed.Close()
+	tests := []struct {
+		name, protocol, proxy, stage, message string
+	}{
+		{"closed port", "socks5://", closedAddress, "TCP connect", "refused"},
+		{"socks5 rejection", "socks5://", startSOCKS5Stub(t, 0x02), "SOCKS5 handshake", "not allowed by ruleset"},
+		{"socks4 rejection", "socks4://", startSOCKS4Stub(t, socks4Rejected).address(), "SOCKS4 handshake", "rejected"},
+		{"plain proxy spoken to with TLS", "https://", startHTTPProxyStub(t, false, true), "TLS to proxy", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			failed := diagnoseProxy(context.Background(), test.proxy, nil, test.protocol, target.URL).failedStage()
+			if failed == nil || failed.name != test.stage || !strings.Contains(failed.err.Error(), test.message) {
+				t.Fatalf("failed stage = %+v, want %s mentioning %q", failed, test.stage, test.message)
+			}
+		})
+	}
+}
+
+func TestReportCoversEveryProtocol(t *testing.T) {
+	checker := newTestChecker(startTargetServer(t).URL)
+	// The stub waits for a SOCKS5 greeting, so the other validators would only run into their timeouts.
+	checker.Validators = []Validator{SOCKS5Validator{}}
+	proxy := startSOCKS5Stub(t, socks5Succeeded)
+
+	var report bytes.Buffer
+	if err := checker.Report(context.Background(), &report, source.Proxy{Address: proxy}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report.String(), "Working: socks5://"+proxy) {
+		t.Fatalf("report does not list the working protocol:\n%s", report.String())
+	}
+	if !strings.Contains(report.String(), "FAIL") {
+		t.Fatalf("report does not show the failing protocols:\n%s", report.String())
+	}
+
+	err := checker.Report(context.Background(), io.Discard, source.Proxy{Address: proxy, Protocol: "socks4"})
+	if err == nil || !strings.Contains(err.Error(), "socks4 failed at SOCKS4 handshake") {
+		t.Fatalf("err = %v, want the failing SOCKS4 stage", err)
+	}
+}
+
+func TestReportAgreesWithTheValidatorOnForwardOnlyProxies(t *testing.T) {
+	tunneled := httptest.NewTLSServer(startTargetServer(t).Config.Handler)
+	defer tunneled.Close()
+	forwarded := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/missing" {
+			http.NotFound(writer, request)
+			return
+		}
+		io.WriteString(writer, "hello from the target")
+	}))
+	defer forwarded.Close()
+	proxy := startHTTPProxyStub(t, false, false)
+	tests := []struct {
+		name    string
+		targets []string
+		passes  bool
+	}{
+		{"every forward target passes", []string{tunneled.URL, forwarded.URL + "/"}, true},
+		{"a forward target fails", []string{tunneled.URL, forwarded.URL + "/", forwarded.URL + "/missing"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checker := newTestChecker(test.targets...)
+			checker.Validators = []Validator{HTTPValidator{}}
+			_, validated := checker.Check(context.Background(), source.Proxy{Address: proxy})
+			var report bytes.Buffer
+			err := checker.Report(context.Background(), &report, source.Proxy{Address: proxy, Protocol: "http"})
+			if validated != test.passes || (err == nil) != test.passes {
+				t.Fatalf("validated = %v, check error = %v; want both to pass = %v\n%s", validated, err, test.passes, report.String())
+			}
+		})
+	}
+}
+
+func TestReportNamesTheTamperingSignalTheValidationCaught(t *testing.T) {
+	tunneled := httptest.NewTLSServer(startTargetServer(t).Config.Handler)
+	defer tunneled.Close()
+	forwarded := startTargetServer(t)
+	phishing := startTargetServer(t)
+	// A proxy that sends every request for the target to another host instead.
+	honest := httpProxyStubHandler(true, nil)
+	redirecting := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodGet && request.URL.Host == strings.TrimPrefix(forwarded.URL, "http://") {
+			http.Redirect(writer, request, phishing.URL, http.StatusFound)
+			return
+		}
+		honest.ServeHTTP(writer, request)
+	}))
+	defer redirecting.Close()
+	tests := []struct {
+		name   string
+		target string
+		proxy  string
+		signal string
+	}{
+		{"intercepting proxy", tunneled.URL, startInterceptingProxyStub(t), SignalSelfSignedCertificate},
+		{"redirecting proxy", forwarded.URL, strings.TrimPrefix(redirecting.URL, "http://"), SignalForeignRedirect},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checker := newTestChecker(test.target)
+			checker.RootCAs = serverRootCAs(tunneled)
+			baseline, err := LearnBaseline(context.Background(), checker.Targets, checker.RootCAs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checker.Baseline = baseline
+
+			var report bytes.Buffer
+			err = checker.Report(context.Background(), &report, source.Proxy{Address: test.proxy, Protocol: "http"})
+
+			if err == nil || !strings.Contains(err.Error(), "caught tampering") {
+				t.Fatalf("err = %v, want the tampering verdict\n%s", err, report.String())
+			}
+			if !strings.Contains(report.String(), "Signals: "+test.signal) {
+				t.Fatalf("report does not name the %s signal:\n%s", test.signal, report.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package validate
+
+import (
+	"bufio"           // Provides buffered I/O operations
+	"context"         // Aborts the probes when the run is cancelled
+	"crypto/tls"      // Implements TLS (Transport Layer Security) for secure communication
+	"encoding/base64" // Encodes the proxy credentials for Basic authentication
+	"errors"          // Reports a proxy that does no HTTP proxying
+	"fmt"             // Writes the raw probe requests
+	"net"             // Provides networking utilities
+	"net/http"        // Parses the proxy responses
+	"net/url"         // Handles URL parsing and manipulation
+	"strings"         // Provides string manipulation utilities
+	"time"            // Provides functionality for measuring and displaying time
+
+	"github.com/complexorganizations/proxy-registry/source" // Splits the proxy address
+)
+
+// Time allowed for each capability probe, from dialing to reading the response.
+const capabilityProbeTimeout = time.Second * 30
+
+// What an HTTP-family proxy was found to support on its listening port.
+type Capabilities struct {
+	TLS     bool `json:"tls"`     // The proxy expects TLS on its own port, so it is an https:// proxy
+	Connect bool `json:"connect"` // The proxy tunnels CONNECT requests, so it can reach HTTPS sites
+	Forward bool `json:"forward"` // The proxy forwards plain absolute-form HTTP requests
+}
+
+// Report whether the proxy speaks HTTP proxying in any form.
+func (capabilities Capabilities) IsHTTPProxy() bool {
+	return capabilities.Connect || capabilities.Forward
+}
+
+// Return the scheme prefix that matches how the proxy must be contacted.
+func (capabilities Capabilities) SchemePrefix() string {
+	// A TLS listener needs the https:// scheme, everything else is plain http://.
+	if capabilities.TLS {
+		return "https://"
+	}
+	return "http://"
+}
+
+// Return the capabilities as a comma separated list, such as "tls,connect,forward".
+func (capabilities Capabilities) String() string {
+	// Collect the names of the supported capabilities.
+	var names []string
+	if capabilities.TLS {
+		names = append(names, "tls")
+	}
+	if capabilities.Connect {
+		names = append(names, "connect")
+	}
+	if capabilities.Forward {
+		names = append(names, "forward")
+	}
+	// A proxy that supports nothing is reported as such.
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// Find out whether the proxy speaks TLS on its port and which kinds of HTTP proxying it supports.
+// The user holds the credentials sent with every probe and is nil when the proxy needs none.
+func DetectCapabilities(ctx context.Context, content string, user *url.Userinfo, targets []string) Capabilities {
+	// Create a value to record the results.
+	var capabilities Capabilities
+	// Without a target there is nothing to probe with.
+	if len(targets) == 0 {
+		return capabilities
+	}
+	// Use the first validation target for the probes, and the first target of forward-only proxies for forwarding.
+	requestURL, _ := prepareTarget(targets[0])
+	target, err := url.Parse(requestURL)
+	if err != nil {
+		return capabilities
+	}
+	forwardURL, _ := prepareTarget(forwardTargets(targets)[0])
+	forwardTarget, err := url.Parse(forwardURL)
+	if err != nil {
+		return capabilities
+	}
+	// Check whether the proxy completes a TLS handshake on its own port.
+	capabilities.TLS = proxySpeaksTLS(ctx, content)
+	// Check whether the proxy opens a tunnel to the target.
+	capabilities.Connect = probeProxyConnect(ctx, content, user, capabilities.TLS, targetHostPort(target))
+	// Check whether the proxy fetches a plain HTTP page on our behalf.
+	capabilities.Forward = probeProxyForward(ctx, content, user, capabilities.TLS, plainHTTPTarget(forwardTarget))
+	// Return what was found.
+	return capabilities
+}
+
+// Validates HTTP proxies, telling plain http:// proxies from https:// ones that expect TLS on their port.
+type HTTPValidator struct{}
+
+// Return the protocol family the validator tests.
+func (HTTPValidator) Scheme() string {
+	return "http"
+}
+
+// Detect the capabilities of the proxy, which decides between http:// and https://, and request every target through it.
+// A proxy that only forwards plain HTTP requests the http:// targets instead, or the plain HTTP version of every target.
+func (HTTPValidator) Validate(ctx context.Context, address string, user *url.Userinfo, targets []string) (ProtocolResult, error) {
+	// Find out whether the proxy speaks TLS and whether it tunnels or only forwards
+	capabilities := DetectCapabilities(ctx, address, user, targets)
+	scheme := capabilities.SchemePrefix()
+	result := ProtocolResult{Scheme: schemeName(scheme), URL: scheme + address, capabilities: &capabilities}
+	switch {
+	case capabilities.Connect:
+		// A tunneling proxy must reach every validation target as it is
+	case capabilities.Forward:
+		// A forward-only proxy cannot reach HTTPS sites, so it must fetch every plain HTTP target
+		targets = forwardTargets(targets)
+	default:
+		return result, errors.New("the proxy neither tunnels nor forwards requests")
+	}
+	checked, err := checkTargets(ctx, withUser(result.URL, user), targets)
+	if err != nil {
+		return result, err
+	}
+	result.Targets = checked
+	result.LatencyMS = averageTotalMS(checked)
+	return result, nil
+}
+
+// Return the targets a forward-only proxy fetches with absolute-form requests: the http:// targets when any are
+// configured, since they name the plain HTTP pages to use, and otherwise the plain HTTP version of every target.
+// The placeholders and the fragment are kept, so the body is checked the same way.
+func forwardTargets(targets []string) []string {
+	// Prefer the plain HTTP targets named by the operator.
+	var plain []string
+	for _, target := range targets {
+		if parsed, err := url.Parse(target); err == nil && parsed.Scheme == "http" {
+			plain = append(plain, target)
+		}
+	}
+	if len(plain) > 0 {
+		return plain
+	}
+	// Otherwise rewrite every HTTPS target.
+	forwarded := make([]string, 0, len(targets))
+	for _, target := range targets {
+		if parsed, err := url.Parse(target); err == nil && parsed.Scheme == "https" {
+			target = plainHTTPTarget(parsed)
+		}
+		forwarded = append(forwarded, target)
+	}
+	return forwarded
+}
+
+// Return the Proxy-Authorization header line for the credentials, or nothing when there are none.
+func proxyAuthorizationHeader(user *url.Userinfo) string {
+	if user == nil {
+		return ""
+	}
+	password, _ := user.Password()
+	return "Proxy-Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+password)) + "\r\n"
+}
+
+// Return the target as a plain http:// URL; the host is kept as written, brackets and explicit port included.
+func plainHTTPTarget(target *url.URL) string {
+	plainTarget := *target
+	plainTarget.Scheme = "http"
+	return plainTarget.String()
+}
+
+// Return the host:port of the URL, filling in the default port of the scheme.
+func targetHostPort(target *url.URL) string {
+	// Keep an explicit port as it is.
+	if target.Port() != "" {
+		return target.Host
+	}
+	// Fall back to the default port of the scheme.
+	if target.Scheme == "http" {
+		return net.JoinHostPort(target.Hostname(), "80")
+	}
+	return net.JoinHostPort(target.Hostname(), "443")
+}
+
+// A connection that is closed as soon as its context is cancelled, so no read outlives the run.
+type cancelableConn struct {
+	net.Conn
+	stop func() bool // Unregisters the close on cancellation
+}
+
+// Wrap the connection so it is closed when the context is cancelled.
+func closeOnCancel(ctx context.Context, conn net.Conn) net.Conn {
+	return cancelableConn{Conn: conn, stop: context.AfterFunc(ctx, func() { conn.Close() })}
+}
+
+// Close the connection and forget the context.
+func (conn cancelableConn) Close() error {
+	conn.stop()
+	return conn.Conn.Close()
+}
+
+// Connect to the proxy, wrapping the connection in TLS when asked to.
+func dialProxyForProbe(ctx context.Context, content string, useTLS bool) (net.Conn, error) {
+	// Open the TCP connection to the proxy.
+	dialer := &net.Dialer{Timeout: capabilityProbeTimeout}
+	dialed, err := dialer.DialContext(ctx, "tcp", pinnedAddressFrom(ctx, content))
+	if err != nil {
+		return nil, err
+	}
+	// Close the connection if the run is cancelled in the middle of the probe.
+	conn := closeOnCancel(ctx, dialed)
+	// Bound the whole probe, including the handshake and the response.
+	_ = conn.SetDeadline(time.Now().Add(capabilityProbeTimeout))
+	// Return the plain connection when TLS is not wanted.
+	if !useTLS {
+		return conn, nil
+	}
+	// Perform the TLS handshake with the proxy itself; proxy certificates are rarely valid.
+	host, _ := source.SplitHostPort(content)
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// Return the encrypted connection.
+	return tlsConn, nil
+}
+
+// Report whether the proxy completes a TLS handshake on its listening port.
+func proxySpeaksTLS(ctx context.Context, content string) bool {
+	// A successful dial with TLS means the handshake worked.
+	conn, err := dialProxyForProbe(ctx, content, true)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Report whether the proxy answers a CONNECT request to the target with a 2xx status.
+func probeProxyConnect(ctx context.Context, content string, user *url.Userinfo, useTLS bool, targetAddress string) bool {
+	// Connect to the proxy.
+	conn, err := dialProxyForProbe(ctx, content, useTLS)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	// Ask the proxy to open a tunnel to the target.
+	_, err = fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n%s\r\n", targetAddress, targetAddress, proxyAuthorizationHeader(user))
+	if err != nil {
+		return false
+	}
+	// Read the proxy answer; a CONNECT response never has a body.
+	response, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return false
+	}
+	response.Body.Close()
+	// Any 2xx status means the tunnel is open.
+	return response.StatusCode >= 200 && response.StatusCode < 300
+}
+
+// Report whether the proxy forwards a plain absolute-form GET request and returns the page.
+func probeProxyForward(ctx context.Context, content string, user *url.Userinfo, useTLS bool, targetURL string) bool {
+	// Parse the target so the Host header can be filled in.
+	target, err := url.Parse(targetURL)
+	if err != nil {
+		return false
+	}
+	// Connect to the proxy.
+	conn, err := dialProxyForProbe(ctx, content, useTLS)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	// Ask the proxy to fetch the page for us.
+	_, err = fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n%s\r\n", target.String(), target.Host, proxyAuthorizationHeader(user))
+	if err != nil {
+		return false
+	}
+	// Read the proxy answer.
+	response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return false
+	}
+	response.Body.Close()
+	// A 2xx or 3xx status means the request reached the site; plain HTTP often redirects to HTTPS.
+	return response.StatusCode >= 200 && response.StatusCode < 400
+}
@@ -0,0 +1,234 @@
+package validate
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Return a handler that behaves like a minimal HTTP proxy, optionally refusing CONNECT
+// and adding the given headers to every forwarded request.
+func httpProxyStubHandler(allowConnect bool, addHeaders http.Header) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodConnect {
+			if !allowConnect {
+				http.Error(writer, "CONNECT not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			target, err := net.Dial("tcp", request.Host)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusBadGateway)
+				return
+			}
+			defer target.Close()
+			conn, buffered, err := writer.(http.Hijacker).Hijack()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+			go io.Copy(target, buffered)
+			io.Copy(conn, target)
+			return
+		}
+		if !request.URL.IsAbs() {
+			http.Error(writer, "not a proxy request", http.StatusBadRequest)
+			return
+		}
+		outgoing := request.Clone(request.Context())
+		outgoing.RequestURI = ""
+		for key, values := range addHeaders {
+			outgoing.Header[key] = values
+		}
+		response, err := http.DefaultTransport.RoundTrip(outgoing)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer response.Body.Close()
+		for key, values := range response.Header {
+			for _, value := range values {
+				writer.Header().Add(key, value)
+			}
+		}
+		writer.WriteHeader(response.StatusCode)
+		io.Copy(writer, response.Body)
+	})
+}
+
+// Start a stub HTTP proxy, speaking TLS on its port when asked to, and return its host:port.
+func startHTTPProxyStub(t *testing.T, useTLS bool, allowConnect bool) string {
+	t.Helper()
+	return startHTTPProxyStubWithHeaders(t, useTLS, allowConnect, nil)
+}
+
+// Start a stub HTTP proxy that adds the given headers to every forwarded request.
+func startHTTPProxyStubWithHeaders(t *testing.T, useTLS bool, allowConnect bool, addHeaders http.Header) string {
+	t.Helper()
+	var server *httptest.Server
+	if useTLS {
+		server = httptest.NewTLSServer(httpProxyStubHandler(allowConnect, addHeaders))
+	} else {
+		server = httptest.NewServer(httpProxyStubHandler(allowConnect, addHeaders))
+	}
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(strings.TrimPrefix(server.URL, "https://"), "http://")
+}
+
+// Start a stub HTTP proxy that answers 407 to every request without the given Basic credentials.
+func startAuthenticatingHTTPProxyStub(t *testing.T, username string, password string) string {
+	t.Helper()
+	proxy := httpProxyStubHandler(true, nil)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		check := &http.Request{Header: http.Header{"Authorization": request.Header["Proxy-Authorization"]}}
+		if user, pass, ok := check.BasicAuth(); !ok || user != username || pass != password {
+			http.Error(writer, "proxy authentication required", http.StatusProxyAuthRequired)
+			return
+		}
+		proxy.ServeHTTP(writer, request)
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// Create a checker that requests only the given targets.
+func newTestChecker(targets ...string) *Checker {
+	checker := NewChecker()
+	checker.Targets = targets
+	return checker
+}
+
+func TestDetectCapabilities(t *testing.T) {
+	target := startTargetServer(t)
+	tests := []struct {
+		name         string
+		useTLS       bool
+		allowConnect bool
+		want         Capabilities
+		wantScheme   string
+	}{
+		{"plain proxy with CONNECT", false, true, Capabilities{Connect: true, Forward: true}, "http://"},
+		{"plain forward-only proxy", false, false, Capabilities{Forward: true}, "http://"},
+		{"TLS proxy with CONNECT", true, true, Capabilities{TLS: true, Connect: true, Forward: true}, "https://"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := startHTTPProxyStub(t, test.useTLS, test.allowConnect)
+			got := DetectCapabilities(context.Background(), proxy, nil, []string{target.URL})
+			if got != test.want {
+				t.Fatalf("capabilities = %s, want %s", got, test.want)
+			}
+			result, err := HTTPValidator{}.Validate(context.Background(), proxy, nil, []string{target.URL})
+			if err != nil || result.URL != test.wantScheme+proxy {
+				t.Fatalf("Validate = %q, %v, want %q, nil", result.URL, err, test.wantScheme+proxy)
+			}
+		})
+	}
+}
+
+func TestDetectCapabilitiesOfNonProxy(t *testing.T) {
+	target := startTargetServer(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	if got := DetectCapabilities(context.Background(), listener.Addr().String(), nil, []string{target.URL}); got.IsHTTPProxy() || got.TLS {
+		t.Fatalf("capabilities = %s, want none", got)
+	}
+}
+
+func TestHTTPValidatorSendsProxyCredentials(t *testing.T) {
+	target := startTargetServer(t)
+	proxy := startAuthenticatingHTTPProxyStub(t, "alice", "secret")
+
+	result, err := HTTPValidator{}.Validate(context.Background(), proxy, url.UserPassword("alice", "secret"), []string{target.URL})
+	if err != nil {
+		t.Fatalf("expected the credentials to be accepted: %v", err)
+	}
+	if !result.capabilities.Connect || !result.capabilities.Forward || result.URL != "http://"+proxy {
+		t.Fatalf("result = %+v, capabilities = %+v", result, result.capabilities)
+	}
+	if _, err := (HTTPValidator{}).Validate(context.Background(), proxy, nil, []string{target.URL}); err == nil {
+		t.Fatal("expected a proxy that requires credentials to fail without them")
+	}
+}
+
+func TestForwardTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []string
+		want    []string
+	}{
+		{
+			name: "rewrites https targets",
+			targets: []string{
+				"https://example.com/robots.txt#sha256=" + strings.Repeat("ab", 32),
+				"https://judge.example.com:8443/target?nonce=" + NoncePlaceholder,
+				"https://[2001:db8::1]:8443/x",
+				"https://[2001:db8::1]/x",
+			},
+			want: []string{
+				"http://example.com/robots.txt#sha256=" + strings.Repeat("ab", 32),
+				"http://judge.example.com:8443/target?nonce=" + NoncePlaceholder,
+				"http://[2001:db8::1]:8443/x",
+				"http://[2001:db8::1]/x",
+			},
+		},
+		{
+			name: "prefers the http targets",
+			targets: []string{
+				"https://judge.example.com:8443/target?nonce=" + NoncePlaceholder,
+				"http://judge.example.com:8080/target?nonce=" + NoncePlaceholder,
+			},
+			want: []string{"http://judge.example.com:8080/target?nonce=" + NoncePlaceholder},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := forwardTargets(test.targets)
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Fatalf("forwardTargets = %v, want %v", got, test.want)
+			}
+			for _, target := range got {
+				if _, err := url.Parse(target); err != nil {
+					t.Fatalf("forwardTargets returned the invalid URL %q: %v", target, err)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPValidatorRequestsEveryTargetThroughAForwardOnlyProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/missing" {
+			http.NotFound(writer, request)
+			return
+		}
+		io.WriteString(writer, "hello from the target")
+	}))
+	defer target.Close()
+	proxy := startHTTPProxyStub(t, false, false)
+
+	result, err := HTTPValidator{}.Validate(context.Background(), proxy, nil, []string{target.URL + "/", target.URL + "/other"})
+	if err != nil || len(result.Targets) != 2 || result.capabilities.Connect {
+		t.Fatalf("result = %+v, err = %v, want both targets fetched by forwarding", result, err)
+	}
+	if _, err := (HTTPValidator{}).Validate(context.Background(), proxy, nil, []string{target.URL + "/", target.URL + "/missing"}); err == nil {
+		t.Fatal("expected a forward-only proxy to fail when a target does not return 200")
+	}
+}
@@ -0,0 +1,211 @@
+package validate
+
+import (
+	"bytes"         // Compares the issuer and the subject of certificates
+	"context"       // Carries the trusted certificate authorities to the proxy clients
+	"crypto/sha256" // Hashes the response bodies
+	"crypto/tls"    // Recognizes the certificate verification failures
+	"crypto/x509"   // Holds the trusted certificate authorities
+	"encoding/hex"  // Writes the body hashes as text
+	"errors"        // Marks the failures that mean the proxy tampers with the traffic
+	"fmt"           // Formats the tampering reasons
+	"os"            // Reads the certificate authority file
+	"strings"       // Provides string manipulation utilities
+)
+
+// Written after the hash mark of a target URL, such as https://example.com/robots.txt#sha256=<hex>, this gives the
+// SHA-256 the response body must have. The fragment is never sent, so the target sees the URL without it.
+const BodyHashPrefix = "sha256="
+
+// Matches every error that means a proxy was caught changing the traffic it carries: a target certificate that does not
+// verify, a body that is not the one the target sent, rewritten request headers or a redirect the target never makes.
+var ErrTampering = errors.New("tampering")
+
+// Signals that give a tampering proxy away.
+const (
+	SignalSelfSignedCertificate = "self-signed-certificate" // The target presented a certificate signed by itself
+	SignalUntrustedCertificate  = "untrusted-certificate"   // The target certificate does not verify for another reason
+	SignalModifiedBody          = "modified-body"           // The body is not the nonce or does not have the expected hash
+	SignalInjectedContent       = "injected-content"        // The nonce came back with content added around it
+	SignalRewrittenHeaders      = "rewritten-headers"       // The judge did not receive the request headers as they were sent
+	SignalForeignRedirect       = "foreign-redirect"        // The target redirected to a host it does not redirect to without the proxy
+)
+
+// How much each signal adds to the tamper score of a proxy; certain interception scores 100.
+var signalScores = map[string]int{
+	SignalSelfSignedCertificate: 100,
+	SignalUntrustedCertificate:  60,
+	SignalModifiedBody:          60,
+	SignalInjectedContent:       80,
+	SignalRewrittenHeaders:      30,
+	SignalForeignRedirect:       80,
+}
+
+// A proxy caught tampering with the traffic, with the signal that gave it away.
+type TamperingError struct {
+	Signal string // One of the Signal constants
+	Reason string // What was observed
+}
+
+// Return the reason behind the tampering marker.
+func (err *TamperingError) Error() string {
+	return ErrTampering.Error() + ": " + err.Reason
+}
+
+// Match ErrTampering, so errors.Is recognizes every tampering error.
+func (err *TamperingError) Is(target error) bool {
+	return target == ErrTampering
+}
+
+// Return an error that marks the proxy as tampering, with the signal and the reason.
+func tamperingError(signal string, format string, args ...any) error {
+	return &TamperingError{Signal: signal, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Report whether the error means the proxy tampers with the traffic.
+func IsTampering(err error) bool {
+	return errors.Is(err, ErrTampering)
+}
+
+// Return the reason of a tampering error, such as "https://example.com: response body does not echo the nonce".
+func tamperingReason(err error) string {
+	return strings.Replace(err.Error(), ErrTampering.Error()+": ", "", 1)
+}
+
+// Return the signal of a tampering error, or nothing when the error is not one.
+func tamperingSignal(err error) string {
+	var tampering *TamperingError
+	if errors.As(err, &tampering) {
+		return tampering.Signal
+	}
+	return ""
+}
+
+// Mark a failed request as tampering when the certificate presented for the target does not verify,
+// which through a proxy means someone in between answered the TLS handshake.
+func classifyRequestError(err error) error {
+	var verification *tls.CertificateVerificationError
+	if errors.As(err, &verification) && len(verification.UnverifiedCertificates) > 0 {
+		return certificateTampering(verification.UnverifiedCertificates[0], err)
+	}
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) {
+		return tamperingError(SignalUntrustedCertificate, "target certificate does not verify: %v", err)
+	}
+	return err
+}
+
+// Return the tampering error for a target certificate that failed verification, telling a self-signed one,
+// which only an intercepting proxy presents, from the other failures.
+func certificateTampering(certificate *x509.Certificate, err error) error {
+	if isSelfSigned(certificate) {
+		return tamperingError(SignalSelfSignedCertificate, "target presented a self-signed certificate for %s: %v", certificateName(certificate), err)
+	}
+	return tamperingError(SignalUntrustedCertificate, "target certificate for %s issued by %s does not verify: %v", certificateName(certificate), certificate.Issuer.CommonName, err)
+}
+
+// Report whether the certificate names itself as its issuer and is signed with its own key.
+func isSelfSigned(certificate *x509.Certificate) bool {
+	return bytes.Equal(certificate.RawIssuer, certificate.RawSubject) &&
+		certificate.CheckSignature(certificate.SignatureAlgorithm, certificate.RawTBSCertificate, certificate.Signature) == nil
+}
+
+// Return the common name of the certificate, or its first DNS name when it has none.
+func certificateName(certificate *x509.Certificate) string {
+	switch {
+	case certificate.Subject.CommonName != "":
+		return certificate.Subject.CommonName
+	case len(certificate.DNSNames) > 0:
+		return certificate.DNSNames[0]
+	}
+	return "an unnamed host"
+}
+
+// What the body of a target must hold, as asked for by its URL.
+type targetExpectation struct {
+	nonce  string // Value the body must echo, empty when the target has no nonce placeholder
+	sha256 string // SHA-256 the body must have in hex, empty when the target gives none
+}
+
+// Check the body against the expectation, reporting any difference as tampering.
+// A nonce must come back alone, so a page with anything injected around it fails as well.
+func (expectation targetExpectation) check(body []byte) error {
+	if expectation.sha256 != "" {
+		sum := sha256.Sum256(body)
+		if hex.EncodeToString(sum[:]) != expectation.sha256 {
+			return tamperingError(SignalModifiedBody, "response body does not match the expected SHA-256")
+		}
+	}
+	if expectation.nonce != "" {
+		echoed := strings.TrimSpace(string(body))
+		if echoed == expectation.nonce {
+			return nil
+		}
+		if strings.Contains(echoed, expectation.nonce) {
+			return tamperingError(SignalInjectedContent, "response body has content added around the nonce")
+		}
+		return tamperingError(SignalModifiedBody, "response body does not echo the nonce")
+	}
+	return nil
+}
+
+// Describe what the body was checked for, such as "nonce echoed", or nothing when there was no expectation.
+func (expectation targetExpectation) String() string {
+	var checks []string
+	if expectation.nonce != "" {
+		checks = append(checks, "nonce echoed")
+	}
+	if expectation.sha256 != "" {
+		checks = append(checks, "SHA-256 matches")
+	}
+	return strings.Join(checks, ", ")
+}
+
+// Check that a #sha256= fragment of the target, if any, holds a full hex SHA-256, the only fragment that is understood.
+func CheckTargetFragment(target string) error {
+	_, fragment, found := strings.Cut(target, "#")
+	if !found {
+		return nil
+	}
+	hash, ok := strings.CutPrefix(fragment, BodyHashPrefix)
+	if decoded, err := hex.DecodeString(hash); !ok || err != nil || len(decoded) != sha256.Size {
+		return fmt.Errorf("fragment %q of %s is not %s followed by a hex SHA-256", fragment, target, BodyHashPrefix)
+	}
+	return nil
+}
+
+// Key of the trusted certificate authorities in a context.
+type rootCAsKey struct{}
+
+// Return a context that makes the proxy clients trust the given certificate authorities; nil means the system ones.
+func withRootCAs(ctx context.Context, roots *x509.CertPool) context.Context {
+	if roots == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, rootCAsKey{}, roots)
+}
+
+// Return the certificate authorities trusted for the targets, nil meaning the system ones.
+func rootCAsFrom(ctx context.Context) *x509.CertPool {
+	roots, _ := ctx.Value(rootCAsKey{}).(*x509.CertPool)
+	return roots
+}
+
+// Load the system certificate authorities along with the PEM certificates of the file, such as the certificate of a
+// judge server that is not signed by a public authority.
+func LoadRootCAs(path string) (*x509.CertPool, error) {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !roots.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("no PEM certificate found in %s", path)
+	}
+	return roots, nil
+}
@@ -0,0 +1,159 @@
+package validate
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/complexorganizations/proxy-registry/source"
+)
+
+// Return a pool that trusts the certificate of the test server only.
+func serverRootCAs(server *httptest.Server) *x509.CertPool {
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	return roots
+}
+
+// Start a stub HTTP proxy that answers CONNECT requests itself, presenting its own certificate and page,
+// as a TLS intercepting proxy does, and return its host:port.
+func startInterceptingProxyStub(t *testing.T) string {
+	t.Helper()
+	certificate, err := selfSignedCertificate([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodConnect {
+			http.Error(writer, "only CONNECT", http.StatusMethodNotAllowed)
+			return
+		}
+		conn, _, err := writer.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{certificate}})
+		if _, err := http.ReadRequest(bufio.NewReader(tlsConn)); err != nil {
+			return
+		}
+		io.WriteString(tlsConn, "HTTP/1.1 200 OK\r\nContent-Length: 3\r\nConnection: close\r\n\r\nok\n")
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestTargetExpectationCatchesChangedBodies(t *testing.T) {
+	sum := sha256.Sum256([]byte("the original page"))
+	tests := []struct {
+		name        string
+		expectation targetExpectation
+		body        string
+		wantErr     bool
+	}{
+		{"nothing expected", targetExpectation{}, "anything", false},
+		{"nonce echoed", targetExpectation{nonce: "abc"}, "abc\n", false},
+		{"script injected around the nonce", targetExpectation{nonce: "abc"}, "<script src=//ads.example></script>abc\n", true},
+		{"nonce missing", targetExpectation{nonce: "abc"}, "blocked by the proxy", true},
+		{"hash matches", targetExpectation{sha256: hex.EncodeToString(sum[:])}, "the original page", false},
+		{"hash differs", targetExpectation{sha256: hex.EncodeToString(sum[:])}, "the original page<script></script>", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.expectation.check([]byte(test.body))
+			if (err != nil) != test.wantErr || (err != nil && !IsTampering(err)) {
+				t.Fatalf("err = %v, want tampering: %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckTargetFragment(t *testing.T) {
+	sum := sha256.Sum256(nil)
+	valid := []string{"https://example.com/", "https://example.com/robots.txt#sha256=" + hex.EncodeToString(sum[:])}
+	for _, target := range valid {
+		if err := CheckTargetFragment(target); err != nil {
+			t.Errorf("%s: %v", target, err)
+		}
+	}
+	invalid := []string{"https://example.com/#top", "https://example.com/#sha256=abcd", "https://example.com/#sha256=" + strings.Repeat("z", 64)}
+	for _, target := range invalid {
+		if err := CheckTargetFragment(target); err == nil {
+			t.Errorf("%s: expected an error", target)
+		}
+	}
+}
+
+func TestCheckFlagsATLSInterceptingProxy(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		fmt.Fprintln(writer, "ok")
+	}))
+	defer target.Close()
+	checker := newTestChecker(target.URL)
+	checker.RootCAs = serverRootCAs(target)
+	tests := []struct {
+		name, proxy   string
+		wantTampering bool
+	}{
+		{"honest proxy", startHTTPProxyStub(t, false, true), false},
+		{"intercepting proxy", startInterceptingProxyStub(t), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, ok := checker.Check(context.Background(), source.Proxy{Address: test.proxy, Protocol: "http"})
+			if !ok || result.Tampered() != test.wantTampering {
+				t.Fatalf("ok = %v, result = %+v, want tampering: %v", ok, result, test.wantTampering)
+			}
+			if test.wantTampering && (len(result.Protocols) != 1 || !strings.Contains(result.Tampering, "certificate")) {
+				t.Fatalf("result = %+v, want the protocol and the certificate named", result)
+			}
+			if test.wantTampering && (len(result.TamperSignals) != 1 || result.TamperSignals[0] != SignalSelfSignedCertificate || result.TamperScore != 100) {
+				t.Fatalf("signals = %v, score = %d, want a self-signed certificate scoring 100", result.TamperSignals, result.TamperScore)
+			}
+			clean, tampering := SplitTampering([]Result{result})
+			if len(tampering) == 1 != test.wantTampering || len(clean) == 1 == test.wantTampering {
+				t.Fatalf("split into %d clean and %d tampering", len(clean), len(tampering))
+			}
+		})
+	}
+}
+
+func TestCheckFlagsAForwardOnlyProxyThatInjectsContent(t *testing.T) {
+	judge := httptest.NewServer(NewJudgeServerHandler())
+	defer judge.Close()
+	// A proxy without CONNECT that adds a script to every page it forwards.
+	honest := httpProxyStubHandler(false, nil)
+	proxy := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodConnect {
+			honest.ServeHTTP(writer, request)
+			return
+		}
+		recorder := httptest.NewRecorder()
+		honest.ServeHTTP(recorder, request)
+		writer.WriteHeader(recorder.Code)
+		fmt.Fprintf(writer, "<script src=\"//ads.example.net/a.js\"></script>%s", recorder.Body.String())
+	}))
+	defer proxy.Close()
+	checker := newTestChecker(judge.URL + TargetPath + "?nonce=" + NoncePlaceholder)
+	baseline, err := LearnBaseline(context.Background(), checker.Targets, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker.Baseline = baseline
+
+	result, ok := checker.Check(context.Background(), source.Proxy{Address: strings.TrimPrefix(proxy.URL, "http://"), Protocol: "http"})
+
+	if !ok || len(result.TamperSignals) != 1 || result.TamperSignals[0] != SignalInjectedContent {
+		t.Fatalf("ok = %v, result = %+v, want the injected content caught", ok, result)
+	}
+}
@@ -0,0 +1,233 @@
+package validate
+
+import (
+	"context"       // Cancels the judge requests when the run is cancelled
+	"encoding/json" // Encodes and decodes the judge responses
+	"fmt"           // Formats the judge error messages
+	"io"            // Provides basic I/O primitives
+	"log"           // Implements logging functionality
+	"net"           // Provides networking utilities
+	"net/http"      // Provides HTTP client and server implementations
+	"net/url"       // Handles URL parsing and manipulation
+	"strings"       // Provides string manipulation utilities
+	"time"          // Provides functionality for measuring and displaying time
+)
+
+// Anonymity levels a proxy can be classified with.
+const (
+	AnonymityTransparent = "transparent" // The proxy reveals the real client address
+	AnonymityAnonymous   = "anonymous"   // The proxy hides the address but announces itself as a proxy
+	AnonymityElite       = "elite"       // The proxy hides the address and leaves no proxy headers
+)
+
+// Largest judge response that is read, a real one is a few kilobytes.
+const maxJudgeResponseSize = 64 << 10
+
+// Header sent with every judge request through a proxy, carrying a random value that must reach the judge unchanged.
+const canaryHeader = "X-Proxy-Registry-Canary"
+
+// User agent sent with every judge request, which must reach the judge unchanged.
+const judgeUserAgent = "proxy-registry"
+
+// Headers that proxies add to announce themselves or to pass the client address on.
+var proxyRevealingHeaders = []string{
+	"Via",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+	"Forwarded",
+	"X-Real-Ip",
+	"X-Client-Ip",
+	"Client-Ip",
+	"X-Proxy-Id",
+	"Proxy-Connection",
+	"X-Bluecoat-Via",
+	"X-Originating-Ip",
+}
+
+// A judge server used to classify the anonymity of proxies.
+type Judge struct {
+	URL    string // URL of the judge
+	RealIP string // Our own public address as seen by the judge; a proxy that leaks it is transparent
+}
+
+// What the judge saw of a request, as returned in its JSON body.
+type judgeResponse struct {
+	RemoteAddress string              `json:"remote_address"` // Address the request came from
+	Method        string              `json:"method"`         // Method of the request
+	Host          string              `json:"host"`           // Host the request was sent to
+	Headers       map[string][]string `json:"headers"`        // Every request header
+}
+
+// Return a handler that echoes the client address and the request headers as JSON.
+func NewJudgeHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		// Only plain reads are answered.
+		if request.Method != http.MethodGet && request.Method != http.MethodHead {
+			http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// Use the address of the TCP peer only; headers are exactly what is being judged.
+		remoteAddress, _, err := net.SplitHostPort(request.RemoteAddr)
+		if err != nil {
+			remoteAddress = request.RemoteAddr
+		}
+		// Describe the request.
+		response := judgeResponse{
+			RemoteAddress: remoteAddress,
+			Method:        request.Method,
+			Host:          request.Host,
+			Headers:       request.Header,
+		}
+		// Make sure no cache in between serves an old answer.
+		writer.Header().Set("Cache-Control", "no-store")
+		writer.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(writer).Encode(response); err != nil {
+			log.Println("Error writing judge response:", err)
+		}
+	})
+}
+
+// Run the built-in judge server on the given address until it fails.
+// Besides the anonymity judge it serves the known-content target on /target.
+func ServeJudge(address string) error {
+	server := newJudgeServer(address)
+	log.Println("Judge server listening on", address)
+	// Serve until an error stops the server.
+	return server.ListenAndServe()
+}
+
+// Ask the judge what it sees of a request made with the given client, sending the canary header unless it is empty.
+func queryJudge(ctx context.Context, client *http.Client, judge string, canary string) (judgeResponse, error) {
+	// Create a value to store the answer.
+	var answer judgeResponse
+	// Request the judge page.
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, judge, nil)
+	if err != nil {
+		return answer, err
+	}
+	request.Header.Set("User-Agent", judgeUserAgent)
+	if canary != "" {
+		request.Header.Set(canaryHeader, canary)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return answer, err
+	}
+	defer response.Body.Close()
+	// Anything else than 200 means the request did not reach the judge.
+	if response.StatusCode != http.StatusOK {
+		return answer, fmt.Errorf("judge returned HTTP status %d", response.StatusCode)
+	}
+	// Decode the answer, reading no more than a judge could reasonably send.
+	if err := json.NewDecoder(io.LimitReader(response.Body, maxJudgeResponseSize)).Decode(&answer); err != nil {
+		return answer, fmt.Errorf("judge returned an invalid response: %w", err)
+	}
+	// Return the answer.
+	return answer, nil
+}
+
+// Learn our own public address from the judge, so proxies can be classified against it.
+func NewJudge(ctx context.Context, judge string) (*Judge, error) {
+	// Make sure the judge URL is usable.
+	parsedURL, err := url.ParseRequestURI(judge)
+	if err != nil || parsedURL.Host == "" {
+		return nil, fmt.Errorf("invalid judge URL %q", judge)
+	}
+	// Ask the judge directly, without a proxy, which address it sees.
+	answer, err := queryJudge(ctx, &http.Client{Timeout: time.Second * 30}, judge, "")
+	if err != nil {
+		return nil, fmt.Errorf("contacting judge %s: %w", judge, err)
+	}
+	// Remember the address so leaks can be recognized.
+	log.Println("Judge", judge, "sees this machine as", answer.RemoteAddress)
+	return &Judge{URL: judge, RealIP: answer.RemoteAddress}, nil
+}
+
+// Classify the anonymity of the proxy by asking the judge what it sees through it.
+// A nil judge classifies every proxy as unknown.
+func (judge *Judge) Classify(ctx context.Context, proxy string) string {
+	anonymity, _ := judge.classify(ctx, proxy)
+	return anonymity
+}
+
+// Classify the anonymity of the proxy, and return a tampering error when the request headers did not reach the judge
+// as they were sent. Headers a proxy adds are part of the classification, not tampering.
+func (judge *Judge) classify(ctx context.Context, proxy string) (string, error) {
+	// Without a judge there is nothing to classify against.
+	if judge == nil || judge.URL == "" || judge.RealIP == "" {
+		return AnonymityUnknown, nil
+	}
+	// Parse the proxy URL.
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return AnonymityUnknown, nil
+	}
+	canary, err := randomNonce()
+	if err != nil {
+		return AnonymityUnknown, nil
+	}
+	// Ask the judge through the proxy.
+	client, transport := newProxyClient(ctx, proxyURL)
+	defer transport.CloseIdleConnections()
+	answer, err := queryJudge(ctx, client, judge.URL, canary)
+	if err != nil {
+		return AnonymityUnknown, nil
+	}
+	// Decide the level from the answer, then check what happened to our own headers.
+	return anonymityFromJudgeResponse(answer, judge.RealIP), checkJudgeHeaders(answer, canary)
+}
+
+// Check that the judge received the user agent and the canary header exactly as they were sent.
+func checkJudgeHeaders(answer judgeResponse, canary string) error {
+	headers := http.Header(answer.Headers)
+	if received := headers.Get(canaryHeader); received != canary {
+		return tamperingError(SignalRewrittenHeaders, "judge received the %s header as %q instead of %q", canaryHeader, received, canary)
+	}
+	if received := headers.Get("User-Agent"); received != judgeUserAgent {
+		return tamperingError(SignalRewrittenHeaders, "judge received the User-Agent %q instead of %q", received, judgeUserAgent)
+	}
+	return nil
+}
+
+// Decide the anonymity level from what the judge saw and our real address.
+func anonymityFromJudgeResponse(answer judgeResponse, realIP string) string {
+	// The real address showing up anywhere means the proxy leaks it.
+	if answer.RemoteAddress == realIP {
+		return AnonymityTransparent
+	}
+	for _, values := range answer.Headers {
+		for _, value := range values {
+			if headerMentionsIP(value, realIP) {
+				return AnonymityTransparent
+			}
+		}
+	}
+	// Any proxy header means the proxy announces itself.
+	for _, header := range proxyRevealingHeaders {
+		if len(http.Header(answer.Headers).Values(header)) > 0 {
+			return AnonymityAnonymous
+		}
+	}
+	// Nothing gives the proxy away.
+	return AnonymityElite
+}
+
+// Report whether a header value such as "for=1.2.3.4;proto=http" or "1.2.3.4, 5.6.7.8" contains the address.
+func headerMentionsIP(value string, ip string) bool {
+	// Split the value into the tokens that could hold an address.
+	tokens := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ';' || r == '=' || r == ' ' || r == '"'
+	})
+	// Compare every token, ignoring any port and IPv6 brackets.
+	for _, token := range tokens {
+		if host, _, err := net.SplitHostPort(token); err == nil {
+			token = host
+		}
+		if strings.Trim(token, "[]") == ip {
+			return true
+		}
+	}
+	// The address does not appear in the value.
+	return false
+}
@@ -0,0 +1,99 @@
+package validate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Start the built-in judge on the loopback interface.
+func startJudge(t *testing.T) *httptest.Server {
+	t.Helper()
+	judge := httptest.NewServer(NewJudgeHandler())
+	t.Cleanup(judge.Close)
+	return judge
+}
+
+func TestNewJudgeLearnsTheClientAddress(t *testing.T) {
+	judge, err := NewJudge(context.Background(), startJudge(t).URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if judge.RealIP != "127.0.0.1" {
+		t.Fatalf("real client IP = %q, want 127.0.0.1", judge.RealIP)
+	}
+}
+
+func TestClassifyAnonymityThroughStubProxies(t *testing.T) {
+	judge, err := NewJudge(context.Background(), startJudge(t).URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every stub runs on loopback, so pretend our real address is a public one the judge never sees directly.
+	judge.RealIP = "198.51.100.7"
+	tests := []struct {
+		name    string
+		headers http.Header
+		want    string
+	}{
+		{"leaks the client address", http.Header{"X-Forwarded-For": {"198.51.100.7"}}, AnonymityTransparent},
+		{"leaks the client address in Forwarded", http.Header{"Forwarded": {`for="198.51.100.7:4711";proto=http`}}, AnonymityTransparent},
+		{"announces itself with Via", http.Header{"Via": {"1.1 squid"}}, AnonymityAnonymous},
+		{"forwards an unrelated address", http.Header{"X-Forwarded-For": {"198.51.100.70"}}, AnonymityAnonymous},
+		{"adds nothing", nil, AnonymityElite},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := startHTTPProxyStubWithHeaders(t, false, true, test.headers)
+			if got := judge.Classify(context.Background(), "http://"+proxy); got != test.want {
+				t.Fatalf("anonymity = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestClassifyCatchesRewrittenHeaders(t *testing.T) {
+	judge, err := NewJudge(context.Background(), startJudge(t).URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	judge.RealIP = "198.51.100.7"
+	tests := []struct {
+		name          string
+		headers       http.Header
+		wantTampering bool
+	}{
+		{"adds a proxy header", http.Header{"Via": {"1.1 squid"}}, false},
+		{"rewrites the user agent", http.Header{"User-Agent": {"Mozilla/5.0"}}, true},
+		{"strips the canary", http.Header{canaryHeader: nil}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := startHTTPProxyStubWithHeaders(t, false, true, test.headers)
+			_, err := judge.classify(context.Background(), "http://"+proxy)
+			if IsTampering(err) != test.wantTampering || (err != nil && tamperingSignal(err) != SignalRewrittenHeaders) {
+				t.Fatalf("err = %v, want tampering: %v", err, test.wantTampering)
+			}
+		})
+	}
+}
+
+func TestClassifyAnonymityWithoutAJudge(t *testing.T) {
+	var judge *Judge
+	if got := judge.Classify(context.Background(), "http://127.0.0.1:1"); got != AnonymityUnknown {
+		t.Fatalf("anonymity = %q, want %q", got, AnonymityUnknown)
+	}
+}
+
+func TestJudgeRejectsWrites(t *testing.T) {
+	judge := startJudge(t)
+	response, err := http.Post(judge.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d, want %d", response.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
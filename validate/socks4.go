@@ -0,0 +1,184 @@
+package validate
+
+import (
+	"context"         // Carries deadlines and cancellation for dials
+	"encoding/binary" // Encodes the destination port in network byte order
+	"errors"          // Creates the SOCKS4 error values
+	"fmt"             // Formats the SOCKS4 error messages
+	"io"              // Provides basic I/O primitives
+	"net"             // Provides networking utilities
+	"net/url"         // Handles URL parsing and manipulation
+	"strconv"         // Converts the destination port to a number
+	"time"            // Provides functionality for measuring and displaying time
+)
+
+// SOCKS4 protocol constants, see https://www.openssh.com/txt/socks4.protocol.
+const (
+	socks4Version        = 0x04 // Version byte of a SOCKS4 request
+	socks4CommandConnect = 0x01 // CONNECT command
+	socks4ReplyVersion   = 0x00 // Version byte of a SOCKS4 reply
+	socks4Granted        = 0x5a // Request granted
+	socks4Rejected       = 0x5b // Request rejected or failed
+	socks4NoIdentd       = 0x5c // Rejected because the proxy cannot reach identd on the client
+	socks4IdentMismatch  = 0x5d // Rejected because identd reported a different user id
+)
+
+// Errors returned when a SOCKS4 proxy refuses a request.
+var (
+	errSOCKS4Rejected      = errors.New("socks4: request rejected or failed")
+	errSOCKS4NoIdentd      = errors.New("socks4: request rejected, proxy cannot connect to identd on the client")
+	errSOCKS4IdentMismatch = errors.New("socks4: request rejected, identd reported a different user id")
+)
+
+// Validates SOCKS4 proxies, or SOCKS4a proxies when the hostnames are resolved by the proxy.
+type SOCKS4Validator struct {
+	RemoteResolve bool // Test the proxy as socks4a://, sending hostnames instead of resolving them locally
+}
+
+// Return the protocol the validator tests.
+func (validator SOCKS4Validator) Scheme() string {
+	if validator.RemoteResolve {
+		return "socks4a"
+	}
+	return "socks4"
+}
+
+// Request every target through the proxy.
+func (validator SOCKS4Validator) Validate(ctx context.Context, address string, user *url.Userinfo, targets []string) (ProtocolResult, error) {
+	return validateScheme(ctx, validator.Scheme(), address, user, targets)
+}
+
+// A dialer that opens TCP connections through a SOCKS4 or SOCKS4a proxy.
+type socks4Dialer struct {
+	proxyAddress  string        // The proxy as host:port
+	userID        string        // User id sent with every request, may be empty
+	remoteResolve bool          // Send hostnames to the proxy (SOCKS4a) instead of resolving them locally
+	timeout       time.Duration // Maximum time for connecting and completing the handshake
+}
+
+// Create a SOCKS4 dialer from a socks4:// or socks4a:// URL, the URL user name is used as the user id.
+func newSOCKS4Dialer(proxyURL *url.URL) *socks4Dialer {
+	return &socks4Dialer{
+		proxyAddress:  proxyURL.Host,
+		userID:        proxyURL.User.Username(),
+		remoteResolve: proxyURL.Scheme == "socks4a",
+		timeout:       time.Second * 30,
+	}
+}
+
+// Connect to the address through the proxy; it satisfies the http.Transport DialContext signature.
+func (dialer *socks4Dialer) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	// SOCKS4 only tunnels TCP.
+	if network != "tcp" && network != "tcp4" {
+		return nil, fmt.Errorf("socks4: unsupported network %q", network)
+	}
+	// Split the destination into its host and port.
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("socks4: invalid destination %q: %w", address, err)
+	}
+	port, err := strconv.ParseUint(portText, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("socks4: invalid destination port %q", portText)
+	}
+	// Build the request before connecting, so resolution problems never open a socket.
+	request, err := dialer.buildRequest(ctx, host, uint16(port))
+	if err != nil {
+		return nil, err
+	}
+	// Connect to the proxy itself.
+	netDialer := &net.Dialer{Timeout: dialer.timeout}
+	conn, err := netDialer.DialContext(ctx, "tcp", dialer.proxyAddress)
+	if err != nil {
+		return nil, err
+	}
+	// Bound the handshake by the timeout and the context deadline, whichever is sooner.
+	deadline := time.Now().Add(dialer.timeout)
+	if contextDeadline, ok := ctx.Deadline(); ok && contextDeadline.Before(deadline) {
+		deadline = contextDeadline
+	}
+	_ = conn.SetDeadline(deadline)
+	// Abort the handshake as soon as the context is cancelled.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	// Perform the handshake and close the connection if it fails.
+	if err := socks4Handshake(conn, request); err != nil {
+		stop()
+		conn.Close()
+		return nil, err
+	}
+	// The connection was closed under the handshake by the cancellation.
+	if !stop() {
+		return nil, ctx.Err()
+	}
+	// Clear the deadline so the tunnel can be used normally.
+	_ = conn.SetDeadline(time.Time{})
+	// Return the established tunnel.
+	return conn, nil
+}
+
+// Build the CONNECT request for the given destination.
+func (dialer *socks4Dialer) buildRequest(ctx context.Context, host string, port uint16) ([]byte, error) {
+	// Start with the version, the command and the port.
+	request := []byte{socks4Version, socks4CommandConnect, 0, 0}
+	binary.BigEndian.PutUint16(request[2:4], port)
+	// Work out the destination address.
+	var hostname string
+	destination := net.ParseIP(host).To4()
+	if destination == nil && net.ParseIP(host) != nil {
+		return nil, fmt.Errorf("socks4: IPv6 destination %s is not supported", host)
+	}
+	if destination == nil {
+		if dialer.remoteResolve {
+			// SOCKS4a marks a hostname with the invalid address 0.0.0.x and appends the name.
+			destination = net.IPv4(0, 0, 0, 1).To4()
+			hostname = host
+		} else {
+			// Plain SOCKS4 needs an IPv4 address, so resolve the name locally.
+			addresses, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+			if err != nil {
+				return nil, fmt.Errorf("socks4: resolving %s: %w", host, err)
+			}
+			destination = addresses[0].To4()
+		}
+	}
+	request = append(request, destination...)
+	// Append the null terminated user id.
+	request = append(request, dialer.userID...)
+	request = append(request, 0)
+	// Append the null terminated hostname for SOCKS4a.
+	if hostname != "" {
+		request = append(request, hostname...)
+		request = append(request, 0)
+	}
+	// Return the complete request.
+	return request, nil
+}
+
+// Send the request over the connection and check the proxy reply.
+func socks4Handshake(conn net.Conn, request []byte) error {
+	// Send the request.
+	if _, err := conn.Write(request); err != nil {
+		return fmt.Errorf("socks4: writing request: %w", err)
+	}
+	// The reply is always eight bytes long.
+	reply := make([]byte, 8)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("socks4: reading reply: %w", err)
+	}
+	// The version byte should be zero, but some servers echo the request version instead.
+	if reply[0] != socks4ReplyVersion && reply[0] != socks4Version {
+		return fmt.Errorf("socks4: unexpected reply version %d", reply[0])
+	}
+	// Translate the reply code.
+	switch reply[1] {
+	case socks4Granted:
+		return nil
+	case socks4Rejected:
+		return errSOCKS4Rejected
+	case socks4NoIdentd:
+		return errSOCKS4NoIdentd
+	case socks4IdentMismatch:
+		return errSOCKS4IdentMismatch
+	}
+	return fmt.Errorf("socks4: unknown reply code %d", reply[1])
+}
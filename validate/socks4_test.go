@@ -0,0 +1,225 @@
+package validate
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// A minimal in-process SOCKS4/4a server that records the requests it receives.
+type socks4Stub struct {
+	listener net.Listener
+	reply    byte // Reply code sent to every client
+
+	mutex     sync.Mutex
+	userIDs   []string
+	hostnames []string
+}
+
+// Start a stub server on the loopback interface that answers every request with the given reply code.
+func startSOCKS4Stub(t *testing.T, reply byte) *socks4Stub {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &socks4Stub{listener: listener, reply: reply}
+	t.Cleanup(func() { listener.Close() })
+	go stub.serve()
+	return stub
+}
+
+func (stub *socks4Stub) address() string {
+	return stub.listener.Addr().String()
+}
+
+func (stub *socks4Stub) serve() {
+	for {
+		conn, err := stub.listener.Accept()
+		if err != nil {
+			return
+		}
+		go stub.handle(conn)
+	}
+}
+
+func (stub *socks4Stub) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return
+	}
+	if header[0] != socks4Version || header[1] != socks4CommandConnect {
+		return
+	}
+	port := binary.BigEndian.Uint16(header[2:4])
+	userID, err := reader.ReadString(0)
+	if err != nil {
+		return
+	}
+	host := net.IP(header[4:8]).String()
+	// An address of 0.0.0.x with a non-zero x means a SOCKS4a hostname follows the user id.
+	var hostname string
+	if header[4] == 0 && header[5] == 0 && header[6] == 0 && header[7] != 0 {
+		hostname, err = reader.ReadString(0)
+		if err != nil {
+			return
+		}
+		hostname = hostname[:len(hostname)-1]
+		host = hostname
+	}
+	stub.mutex.Lock()
+	stub.userIDs = append(stub.userIDs, userID[:len(userID)-1])
+	stub.hostnames = append(stub.hostnames, hostname)
+	stub.mutex.Unlock()
+
+	if stub.reply != socks4Granted {
+		conn.Write([]byte{socks4ReplyVersion, stub.reply, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		conn.Write([]byte{socks4ReplyVersion, socks4Rejected, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	if _, err := conn.Write([]byte{socks4ReplyVersion, socks4Granted, 0, 0, 0, 0, 0, 0}); err != nil {
+		return
+	}
+	go io.Copy(target, reader)
+	io.Copy(conn, target)
+}
+
+// Start an HTTP server that answers every request with a fixed body.
+func startTargetServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		io.WriteString(writer, "hello from the target")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSOCKS4DialerTunnelsHTTP(t *testing.T) {
+	target := startTargetServer(t)
+	tests := []struct {
+		name         string
+		proxyURL     string
+		targetURL    string
+		wantUserID   string
+		wantHostname string
+	}{
+		{
+			name:      "socks4 with IPv4 target",
+			proxyURL:  "socks4://%s",
+			targetURL: target.URL,
+		},
+		{
+			name:       "socks4 with user id",
+			proxyURL:   "socks4://alice@%s",
+			targetURL:  target.URL,
+			wantUserID: "alice",
+		},
+		{
+			name:         "socks4a sends the hostname",
+			proxyURL:     "socks4a://%s",
+			targetURL:    "http://localhost:" + target.URL[strings.LastIndex(target.URL, ":")+1:],
+			wantHostname: "localhost",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub := startSOCKS4Stub(t, socks4Granted)
+			proxyURL, err := url.Parse(fmt.Sprintf(test.proxyURL, stub.address()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			transport := &http.Transport{DialContext: newSOCKS4Dialer(proxyURL).DialContext}
+			defer transport.CloseIdleConnections()
+			response, err := (&http.Client{Transport: transport}).Get(test.targetURL)
+			if err != nil {
+				t.Fatalf("request through socks4 stub failed: %v", err)
+			}
+			body, _ := io.ReadAll(response.Body)
+			response.Body.Close()
+			if string(body) != "hello from the target" {
+				t.Fatalf("unexpected body %q", body)
+			}
+			stub.mutex.Lock()
+			defer stub.mutex.Unlock()
+			if len(stub.userIDs) != 1 {
+				t.Fatalf("expected 1 request, got %d", len(stub.userIDs))
+			}
+			if stub.userIDs[0] != test.wantUserID {
+				t.Errorf("user id = %q, want %q", stub.userIDs[0], test.wantUserID)
+			}
+			if stub.hostnames[0] != test.wantHostname {
+				t.Errorf("hostname = %q, want %q", stub.hostnames[0], test.wantHostname)
+			}
+		})
+	}
+}
+
+func TestSOCKS4DialerReportsRejections(t *testing.T) {
+	tests := []struct {
+		reply byte
+		want  error
+	}{
+		{socks4Rejected, errSOCKS4Rejected},
+		{socks4NoIdentd, errSOCKS4NoIdentd},
+		{socks4IdentMismatch, errSOCKS4IdentMismatch},
+	}
+	for _, test := range tests {
+		stub := startSOCKS4Stub(t, test.reply)
+		dialer := newSOCKS4Dialer(&url.URL{Scheme: "socks4", Host: stub.address()})
+		_, err := dialer.DialContext(context.Background(), "tcp", "127.0.0.1:80")
+		if !errors.Is(err, test.want) {
+			t.Errorf("reply 0x%x: got error %v, want %v", test.reply, err, test.want)
+		}
+	}
+}
+
+func TestSOCKS4DialerRejectsIPv6Destinations(t *testing.T) {
+	dialer := newSOCKS4Dialer(&url.URL{Scheme: "socks4", Host: "127.0.0.1:1"})
+	if _, err := dialer.DialContext(context.Background(), "tcp", "[::1]:80"); err == nil {
+		t.Fatal("expected an error for an IPv6 destination")
+	}
+}
+
+func TestSOCKS4Validator(t *testing.T) {
+	targets := []string{startTargetServer(t).URL}
+	stub := startSOCKS4Stub(t, socks4Granted)
+
+	result, err := SOCKS4Validator{}.Validate(context.Background(), stub.address(), nil, targets)
+	if err != nil {
+		t.Fatalf("expected the socks4 stub to validate: %v", err)
+	}
+	if result.URL != "socks4://"+stub.address() || len(result.Targets) != 1 {
+		t.Fatalf("result = %+v", result)
+	}
+	if _, err := (SOCKS4Validator{}).Validate(context.Background(), stub.address(), url.User("alice"), targets); err != nil {
+		t.Fatalf("expected the socks4 stub to validate with a user id: %v", err)
+	}
+	stub.mutex.Lock()
+	userIDs := append([]string(nil), stub.userIDs...)
+	stub.mutex.Unlock()
+	if userIDs[len(userIDs)-1] != "alice" {
+		t.Fatalf("user ids = %q, want the last one to be alice", userIDs)
+	}
+	rejecting := startSOCKS4Stub(t, socks4Rejected)
+	if _, err := (SOCKS4Validator{}).Validate(context.Background(), rejecting.address(), nil, targets); err == nil {
+		t.Fatal("expected a rejecting socks4 proxy to fail validation")
+	}
+}
@@ -0,0 +1,174 @@
+package validate
+
+import (
+	"context"         // Cancels the validation when the run is cancelled
+	"encoding/binary" // Encodes the destination port in network byte order
+	"errors"          // Creates the SOCKS5 error values
+	"fmt"             // Formats the SOCKS5 error messages
+	"io"              // Provides basic I/O primitives
+	"net"             // Provides networking utilities
+	"net/url"         // Holds the credentials of the proxy
+	"strconv"         // Converts the destination port to a number
+)
+
+// SOCKS5 protocol constants, see RFC 1928.
+const (
+	socks5Version        = 0x05 // Version byte of every SOCKS5 message
+	socks5NoAuth         = 0x00 // The "no authentication required" method
+	socks5UserPass       = 0x02 // The username/password method, see RFC 1929
+	socks5UserPassVer    = 0x01 // Version byte of the username/password subnegotiation
+	socks5NoAcceptable   = 0xff // The proxy accepts none of the offered methods
+	socks5CommandConnect = 0x01 // CONNECT command
+	socks5AddressIPv4    = 0x01 // Destination is an IPv4 address
+	socks5AddressDomain  = 0x03 // Destination is a hostname
+	socks5AddressIPv6    = 0x04 // Destination is an IPv6 address
+	socks5Succeeded      = 0x00 // Request granted
+)
+
+// Errors returned when a SOCKS5 proxy refuses the handshake.
+var (
+	errSOCKS5NoAcceptableMethod = errors.New("socks5: proxy requires authentication")
+	errSOCKS5AuthFailed         = errors.New("socks5: username/password authentication failed")
+)
+
+// Meaning of the SOCKS5 reply codes, from RFC 1928.
+var socks5ReplyMessages = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// Validates SOCKS5 proxies; net/http speaks SOCKS5 itself, so the targets are requested the usual way.
+type SOCKS5Validator struct{}
+
+// Return the protocol the validator tests.
+func (SOCKS5Validator) Scheme() string {
+	return "socks5"
+}
+
+// Request every target through the proxy.
+func (validator SOCKS5Validator) Validate(ctx context.Context, address string, user *url.Userinfo, targets []string) (ProtocolResult, error) {
+	return validateScheme(ctx, validator.Scheme(), address, user, targets)
+}
+
+// Ask the SOCKS5 proxy to connect to the host:port, authenticating with the user when it is not nil.
+func socks5Handshake(conn net.Conn, address string, user *url.Userinfo) error {
+	// Offer the "no authentication" method, and username/password when there are credentials.
+	greeting := []byte{socks5Version, 1, socks5NoAuth}
+	if user != nil {
+		greeting = []byte{socks5Version, 2, socks5NoAuth, socks5UserPass}
+	}
+	if _, err := conn.Write(greeting); err != nil {
+		return fmt.Errorf("socks5: writing greeting: %w", err)
+	}
+	method := make([]byte, 2)
+	if _, err := io.ReadFull(conn, method); err != nil {
+		return fmt.Errorf("socks5: reading method: %w", err)
+	}
+	if method[0] != socks5Version {
+		return fmt.Errorf("socks5: unexpected reply version %d", method[0])
+	}
+	if method[1] == socks5NoAcceptable {
+		return errSOCKS5NoAcceptableMethod
+	}
+	switch {
+	case method[1] == socks5UserPass && user != nil:
+		if err := socks5Authenticate(conn, user); err != nil {
+			return err
+		}
+	case method[1] != socks5NoAuth:
+		return fmt.Errorf("socks5: proxy chose unsupported method %d", method[1])
+	}
+	// Build the CONNECT request for the destination.
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("socks5: invalid destination %q: %w", address, err)
+	}
+	port, err := strconv.ParseUint(portText, 10, 16)
+	if err != nil {
+		return fmt.Errorf("socks5: invalid port %q", portText)
+	}
+	request := []byte{socks5Version, socks5CommandConnect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return fmt.Errorf("socks5: hostname %q is too long", host)
+		}
+		request = append(request, socks5AddressDomain, byte(len(host)))
+		request = append(request, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		request = append(request, socks5AddressIPv4)
+		request = append(request, ip4...)
+	} else {
+		request = append(request, socks5AddressIPv6)
+		request = append(request, ip.To16()...)
+	}
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	if _, err := conn.Write(request); err != nil {
+		return fmt.Errorf("socks5: writing request: %w", err)
+	}
+	// Read the fixed part of the reply.
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("socks5: reading reply: %w", err)
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("socks5: unexpected reply version %d", reply[0])
+	}
+	if reply[1] != socks5Succeeded {
+		if message, ok := socks5ReplyMessages[reply[1]]; ok {
+			return fmt.Errorf("socks5: %s", message)
+		}
+		return fmt.Errorf("socks5: unknown reply code %d", reply[1])
+	}
+	// Skip the bound address and port that follow.
+	var remaining int
+	switch reply[3] {
+	case socks5AddressIPv4:
+		remaining = net.IPv4len + 2
+	case socks5AddressIPv6:
+		remaining = net.IPv6len + 2
+	case socks5AddressDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return fmt.Errorf("socks5: reading reply: %w", err)
+		}
+		remaining = int(length[0]) + 2
+	default:
+		return fmt.Errorf("socks5: unknown address type %d in reply", reply[3])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, remaining)); err != nil {
+		return fmt.Errorf("socks5: reading reply: %w", err)
+	}
+	return nil
+}
+
+// Send the username and password to the proxy and check that it accepts them.
+func socks5Authenticate(conn net.Conn, user *url.Userinfo) error {
+	username := user.Username()
+	password, _ := user.Password()
+	// Both fields are length-prefixed with a single byte.
+	if len(username) == 0 || len(username) > 255 || len(password) > 255 {
+		return errors.New("socks5: username and password must be 1 to 255 bytes long")
+	}
+	request := []byte{socks5UserPassVer, byte(len(username))}
+	request = append(request, username...)
+	request = append(request, byte(len(password)))
+	request = append(request, password...)
+	if _, err := conn.Write(request); err != nil {
+		return fmt.Errorf("socks5: writing credentials: %w", err)
+	}
+	// The reply is a version byte and a status, where zero means success.
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("socks5: reading authentication reply: %w", err)
+	}
+	if reply[1] != 0 {
+		return errSOCKS5AuthFailed
+	}
+	return nil
+}
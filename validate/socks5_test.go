@@ -0,0 +1,41 @@
+package validate
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+func TestSOCKS5ValidatorAuthenticates(t *testing.T) {
+	targets := []string{startTargetServer(t).URL}
+	user := url.UserPassword("alice", "secret")
+	proxy := startAuthenticatingSOCKS5Stub(t, socks5Succeeded, user)
+
+	result, err := SOCKS5Validator{}.Validate(context.Background(), proxy, user, targets)
+	if err != nil {
+		t.Fatalf("expected the credentials to be accepted: %v", err)
+	}
+	if result.URL != "socks5://"+proxy {
+		t.Fatalf("URL = %q, want it without the credentials", result.URL)
+	}
+	if _, err := (SOCKS5Validator{}).Validate(context.Background(), proxy, nil, targets); err == nil {
+		t.Fatal("expected a proxy that requires credentials to fail without them")
+	}
+	if _, err := (SOCKS5Validator{}).Validate(context.Background(), proxy, url.UserPassword("alice", "wrong"), targets); err == nil {
+		t.Fatal("expected a wrong password to fail")
+	}
+}
+
+func TestSOCKS5HandshakeAuthenticates(t *testing.T) {
+	target := startTargetServer(t)
+	user := url.UserPassword("alice", "secret")
+	proxy := startAuthenticatingSOCKS5Stub(t, socks5Succeeded, user)
+
+	if failed := diagnoseProxy(context.Background(), proxy, user, "socks5://", target.URL).failedStage(); failed != nil {
+		t.Fatalf("stage %s failed: %v", failed.name, failed.err)
+	}
+	failed := diagnoseProxy(context.Background(), proxy, url.UserPassword("alice", "wrong"), "socks5://", target.URL).failedStage()
+	if failed == nil || failed.err != errSOCKS5AuthFailed {
+		t.Fatalf("failed stage = %+v, want an authentication failure", failed)
+	}
+}
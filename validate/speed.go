@@ -0,0 +1,159 @@
+package validate
+
+import (
+	"context"            // Cancels the requests when the run is cancelled
+	"fmt"                // Formats the request error messages
+	"io"                 // Provides basic I/O primitives
+	"net/http"           // Provides HTTP client and server implementations
+	"net/http/httptrace" // Reports the connection and response events of a request
+	"net/url"            // Handles URL parsing and manipulation
+	"time"               // Provides functionality for measuring and displaying time
+)
+
+// Largest part of a validation target that is read to measure the total request time.
+const maxTargetBodySize = 1 << 20
+
+// Largest download used to measure throughput.
+const maxThroughputDownloadSize = 4 << 20
+
+// Request the target with the client and measure the connect time, the time to first byte and the total time.
+// A target with a nonce placeholder is requested with a fresh nonce, which the body must echo, and a target with a
+// #sha256= fragment must return a body with that hash; a body that differs, or a target certificate that does not
+// verify, is reported as tampering.
+func timeTargetRequest(ctx context.Context, client *http.Client, target string) (TargetResult, error) {
+	// Create a value to store the timing, under the target as configured.
+	result := TargetResult{Target: target}
+	// Fill in the nonce, if the target asks for one.
+	requestURL, expectation := prepareTarget(target)
+	// Create an HTTP GET request for the target.
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return result, err
+	}
+	// Record the moments the connection to the proxy starts and finishes, and when the first byte arrives.
+	var connectStart, connectDone, firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		ConnectStart: func(network string, address string) {
+			// Only the first dial is the proxy; later ones are fallbacks to other addresses.
+			if connectStart.IsZero() {
+				connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(network string, address string, err error) {
+			if err == nil {
+				connectDone = time.Now()
+			}
+		},
+		GotFirstResponseByte: func() {
+			firstByte = time.Now()
+		},
+	}
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+	// Start the clock just before the request is sent.
+	start := time.Now()
+	// Send the request through the HTTP client configured with the proxy.
+	response, err := client.Do(request)
+	if err != nil {
+		return result, classifyRequestError(err)
+	}
+	// Read the body, up to a limit, so the total covers the whole response.
+	body, readErr := io.ReadAll(io.LimitReader(response.Body, maxTargetBodySize))
+	// Close the response body to free resources, even when the status is not OK.
+	closeErr := response.Body.Close()
+	end := time.Now()
+	// Check if the response status code is 200 (OK).
+	if response.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("unexpected HTTP status %d", response.StatusCode)
+	}
+	if readErr != nil {
+		return result, readErr
+	}
+	if closeErr != nil {
+		return result, closeErr
+	}
+	// A proxy that serves anything but the page asked for is not trusted with the traffic.
+	if err := expectation.check(body); err != nil {
+		return result, err
+	}
+	// Note where the request was redirected, to compare with the baseline.
+	result.redirects = redirectHosts(response)
+	// Fill in the timings; a reused connection has no connect time.
+	if !connectStart.IsZero() && !connectDone.IsZero() {
+		result.ConnectMS = connectDone.Sub(connectStart).Milliseconds()
+	}
+	if !firstByte.IsZero() {
+		result.FirstByteMS = firstByte.Sub(start).Milliseconds()
+	}
+	result.TotalMS = end.Sub(start).Milliseconds()
+	// Return the timing.
+	return result, nil
+}
+
+// Return the average total request time of the targets in milliseconds, or zero when nothing was timed.
+func averageTotalMS(targets []TargetResult) int64 {
+	// Nothing to average.
+	if len(targets) == 0 {
+		return 0
+	}
+	// Sum and divide the total times.
+	var sum int64
+	for _, target := range targets {
+		sum += target.TotalMS
+	}
+	return sum / int64(len(targets))
+}
+
+// Report whether the protocol is too slow for the latency limit; protocols without timings are never rejected.
+func (checker *Checker) isTooSlow(protocol ProtocolResult) bool {
+	return checker.MaxLatency > 0 && len(protocol.Targets) > 0 && time.Duration(protocol.LatencyMS)*time.Millisecond > checker.MaxLatency
+}
+
+// Return the lowest average latency among the protocols, or zero when none was timed.
+func fastestLatencyMS(protocols []ProtocolResult) int64 {
+	// Keep the smallest timed latency.
+	var fastest int64
+	for _, protocol := range protocols {
+		if len(protocol.Targets) > 0 && (fastest == 0 || protocol.LatencyMS < fastest) {
+			fastest = protocol.LatencyMS
+		}
+	}
+	return fastest
+}
+
+// Download the throughput file through the proxy and return the speed in bytes per second, or zero on failure.
+func (checker *Checker) MeasureThroughput(ctx context.Context, proxy string) int64 {
+	// The measurement is optional.
+	if checker.ThroughputURL == "" {
+		return 0
+	}
+	// Parse the proxy URL.
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return 0
+	}
+	// Create an HTTP client that sends every request through the proxy.
+	client, transport := newProxyClient(ctx, proxyURL)
+	defer transport.CloseIdleConnections()
+	// Request the file.
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, checker.ThroughputURL, nil)
+	if err != nil {
+		return 0
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return 0
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return 0
+	}
+	// Time only the transfer of the body, which is what throughput is about.
+	start := time.Now()
+	written, err := io.Copy(io.Discard, io.LimitReader(response.Body, maxThroughputDownloadSize))
+	elapsed := time.Since(start)
+	if err != nil || written == 0 || elapsed <= 0 {
+		return 0
+	}
+	// Convert to bytes per second.
+	return int64(float64(written) / elapsed.Seconds())
+}
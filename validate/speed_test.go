@@ -0,0 +1,113 @@
+package validate
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/complexorganizations/proxy-registry/source"
+)
+
+func TestTimeTargetRequestThroughAProxy(t *testing.T) {
+	target := startTargetServer(t)
+	proxy := startHTTPProxyStub(t, false, true)
+	proxyURL, _ := url.Parse("http://" + proxy)
+	client, transport := newProxyClient(context.Background(), proxyURL)
+	defer transport.CloseIdleConnections()
+
+	result, err := timeTargetRequest(context.Background(), client, target.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Target != target.URL {
+		t.Errorf("target = %q, want %q", result.Target, target.URL)
+	}
+	if result.TotalMS < result.FirstByteMS || result.FirstByteMS < result.ConnectMS {
+		t.Errorf("timings out of order: connect %d, first byte %d, total %d", result.ConnectMS, result.FirstByteMS, result.TotalMS)
+	}
+}
+
+func TestTimeTargetRequestRejectsErrorStatuses(t *testing.T) {
+	target := httptest.NewServer(http.NotFoundHandler())
+	defer target.Close()
+	if _, err := timeTargetRequest(context.Background(), http.DefaultClient, target.URL); err == nil {
+		t.Fatal("expected an error for a 404 response")
+	}
+}
+
+func TestIsTooSlow(t *testing.T) {
+	checker := NewChecker()
+	timed := ProtocolResult{LatencyMS: 2000, Targets: []TargetResult{{TotalMS: 2000}}}
+	untimed := ProtocolResult{}
+
+	checker.MaxLatency = 0
+	if checker.isTooSlow(timed) {
+		t.Error("a zero limit must never reject")
+	}
+	checker.MaxLatency = time.Second
+	if !checker.isTooSlow(timed) {
+		t.Error("a 2s protocol must be rejected by a 1s limit")
+	}
+	if checker.isTooSlow(untimed) {
+		t.Error("a protocol without timings must not be rejected")
+	}
+	checker.MaxLatency = 3 * time.Second
+	if checker.isTooSlow(timed) {
+		t.Error("a 2s protocol must pass a 3s limit")
+	}
+}
+
+func TestFastestLatencyMS(t *testing.T) {
+	protocols := []ProtocolResult{
+		{LatencyMS: 300, Targets: []TargetResult{{TotalMS: 300}}},
+		{},
+		{LatencyMS: 150, Targets: []TargetResult{{TotalMS: 150}}},
+	}
+	if got := fastestLatencyMS(protocols); got != 150 {
+		t.Fatalf("fastest latency = %d, want 150", got)
+	}
+}
+
+func TestMeasureThroughput(t *testing.T) {
+	download := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write(bytes.Repeat([]byte("x"), 256<<10))
+	}))
+	defer download.Close()
+	proxy := startHTTPProxyStub(t, false, true)
+	checker := NewChecker()
+
+	if got := checker.MeasureThroughput(context.Background(), "http://"+proxy); got != 0 {
+		t.Fatalf("throughput without a URL = %d, want 0", got)
+	}
+	checker.ThroughputURL = download.URL
+	if got := checker.MeasureThroughput(context.Background(), "http://"+proxy); got <= 0 {
+		t.Fatalf("throughput = %d, want a positive speed", got)
+	}
+}
+
+func TestForwardOnlyProxiesAreTimed(t *testing.T) {
+	target := startTargetServer(t)
+	// A proxy without CONNECT that takes its time with every page it forwards.
+	forward := httpProxyStubHandler(false, nil)
+	proxy := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		forward.ServeHTTP(writer, request)
+	}))
+	defer proxy.Close()
+	checked := source.Proxy{Address: strings.TrimPrefix(proxy.URL, "http://"), Protocol: "http"}
+	checker := newTestChecker(target.URL)
+
+	result, ok := checker.Check(context.Background(), checked)
+	if !ok || result.Capabilities == nil || result.Capabilities.Connect || result.LatencyMS < 50 {
+		t.Fatalf("ok = %v, result = %+v, want a forward-only proxy with its latency", ok, result)
+	}
+	checker.MaxLatency = 10 * time.Millisecond
+	if _, ok := checker.Check(context.Background(), checked); ok {
+		t.Fatal("expected the slow forward-only proxy to be rejected by the latency limit")
+	}
+}
@@ -0,0 +1,185 @@
+package validate
+
+import (
+	"crypto/ecdsa"     // Generates the key of the self-signed judge certificate
+	"crypto/elliptic"  // Names the curve of the key
+	"crypto/rand"      // Generates the nonces and the certificate serial number
+	"crypto/sha256"    // Fingerprints the self-signed certificate
+	"crypto/tls"       // Serves the judge over HTTPS
+	"crypto/x509"      // Creates the self-signed certificate
+	"crypto/x509/pkix" // Names the subject of the self-signed certificate
+	"encoding/hex"     // Writes the nonces and the fingerprint as text
+	"encoding/pem"     // Writes the self-signed certificate for the validating side
+	"fmt"              // Writes the target bodies and formats the error messages
+	"log"              // Implements logging functionality
+	"math/big"         // Holds the certificate serial number
+	"net"              // Tells the IP addresses of the certificate hosts from the names
+	"net/http"         // Provides HTTP client and server implementations
+	"os"               // Writes the self-signed certificate file
+	"strings"          // Provides string manipulation utilities
+	"time"             // Provides functionality for measuring and displaying time
+)
+
+// Written in a target URL, such as http://judge.example.com:8080/target?nonce={nonce}, this is replaced with a fresh
+// random value for every request, and the response body must echo the value back and nothing else.
+const NoncePlaceholder = "{nonce}"
+
+// Path of the known-content endpoint of the judge server.
+const TargetPath = "/target"
+
+// Return a handler that answers every GET with a small known body: the nonce of the query, or "ok" without one.
+func NewTargetHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		// Only plain reads are answered.
+		if request.Method != http.MethodGet && request.Method != http.MethodHead {
+			http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// Echo the nonce, so a proxy that serves a cached or made-up page is caught.
+		body := "ok"
+		if nonce := request.URL.Query().Get("nonce"); nonce != "" {
+			body = nonce
+		}
+		// Make sure no cache in between serves an old answer.
+		writer.Header().Set("Cache-Control", "no-store")
+		writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(writer, body)
+	})
+}
+
+// Return the handler of the judge server: the known-content target on /target, and the anonymity judge everywhere else.
+func NewJudgeServerHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(TargetPath, NewTargetHandler())
+	mux.Handle("/", NewJudgeHandler())
+	return mux
+}
+
+// Return the URL to request for the target, with a fresh nonce in place of the placeholder and without the fragment,
+// along with what the body must hold: the nonce, and the SHA-256 given by a #sha256= fragment.
+func prepareTarget(target string) (string, targetExpectation) {
+	var expectation targetExpectation
+	// The fragment only carries the expected hash; it is never sent anyway.
+	if before, fragment, found := strings.Cut(target, "#"); found {
+		target = before
+		if hash, ok := strings.CutPrefix(fragment, BodyHashPrefix); ok {
+			expectation.sha256 = strings.ToLower(hash)
+		}
+	}
+	// url.URL.String escapes the braces of a placeholder in the path.
+	placeholders := []string{NoncePlaceholder, "%7Bnonce%7D"}
+	found := false
+	for _, placeholder := range placeholders {
+		found = found || strings.Contains(target, placeholder)
+	}
+	if !found {
+		return target, expectation
+	}
+	nonce, err := randomNonce()
+	if err != nil {
+		return target, expectation
+	}
+	expectation.nonce = nonce
+	for _, placeholder := range placeholders {
+		target = strings.ReplaceAll(target, placeholder, expectation.nonce)
+	}
+	return target, expectation
+}
+
+// Return sixteen random bytes in hex, which cannot be guessed or served from a cache.
+func randomNonce() (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(random), nil
+}
+
+// Create the judge server for the address with timeouts, so slow clients cannot hold connections forever.
+func newJudgeServer(address string) *http.Server {
+	return &http.Server{
+		Addr:              address,
+		Handler:           NewJudgeServerHandler(),
+		ReadHeaderTimeout: time.Second * 10,
+		ReadTimeout:       time.Second * 30,
+		WriteTimeout:      time.Second * 30,
+	}
+}
+
+// Run the judge server over HTTPS on the given address until it fails.
+// Without a certificate and key file a self-signed certificate is generated for the hosts, which default to the host of
+// the address, or the loopback names when it has none. Its PEM is written to certOut when set, so the validating side
+// can trust it with -target-ca, and its fingerprint is logged.
+func ServeJudgeTLS(address string, certFile string, keyFile string, hosts []string, certOut string) error {
+	server := newJudgeServer(address)
+	// Use the given certificate when there is one.
+	if certFile != "" || keyFile != "" {
+		log.Println("Judge server listening with TLS on", address)
+		return server.ListenAndServeTLS(certFile, keyFile)
+	}
+	// Otherwise make one up for this run.
+	hosts = judgeCertificateHosts(address, hosts)
+	certificate, err := selfSignedCertificate(hosts)
+	if err != nil {
+		return fmt.Errorf("creating the judge certificate: %w", err)
+	}
+	if certOut != "" {
+		content := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Certificate[0]})
+		if err := os.WriteFile(certOut, content, 0644); err != nil {
+			return fmt.Errorf("writing the judge certificate: %w", err)
+		}
+		log.Println("Judge certificate written to", certOut, "for -target-ca")
+	}
+	fingerprint := sha256.Sum256(certificate.Certificate[0])
+	log.Printf("Judge server listening with TLS on %s, self-signed certificate for %s, SHA-256 %s", address, strings.Join(hosts, ", "), hex.EncodeToString(fingerprint[:]))
+	server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	return server.ListenAndServeTLS("", "")
+}
+
+// Return the names the generated judge certificate is valid for: the given hosts, else the host of the listen address,
+// else the loopback names, since a wildcard address says nothing about how the judge is reached.
+func judgeCertificateHosts(address string, hosts []string) []string {
+	if len(hosts) > 0 {
+		return hosts
+	}
+	if host, _, err := net.SplitHostPort(address); err == nil && host != "" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsUnspecified() {
+			return []string{host}
+		}
+	}
+	return []string{"localhost", "127.0.0.1", "::1"}
+}
+
+// Create a self-signed certificate valid for a year for the hosts, each a DNS name or an IP address.
+func selfSignedCertificate(hosts []string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "proxy-registry judge"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	// Verification matches the name of the target against these, so every host goes in its own field.
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,150 @@
+package validate
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestTargetHandlerEchoesTheNonce(t *testing.T) {
+	judge := httptest.NewServer(NewJudgeServerHandler())
+	defer judge.Close()
+
+	response, err := http.Get(judge.URL + TargetPath + "?nonce=abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || string(body) != "abc123\n" || response.Header.Get("Cache-Control") != "no-store" {
+		t.Fatalf("status %d, body %q, headers %v", response.StatusCode, body, response.Header)
+	}
+	// Everything else is still the anonymity judge.
+	if _, err := NewJudge(context.Background(), judge.URL+"/"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrepareTarget(t *testing.T) {
+	first, expectation := prepareTarget("http://judge.example.com/target?nonce=" + NoncePlaceholder)
+	second, _ := prepareTarget("http://judge.example.com/target?nonce=" + NoncePlaceholder)
+	if len(expectation.nonce) != 32 || first != "http://judge.example.com/target?nonce="+expectation.nonce || first == second {
+		t.Fatalf("expanded to %q and %q with nonce %q, want a fresh nonce each time", first, second, expectation.nonce)
+	}
+	if plain, expectation := prepareTarget("https://aws.amazon.com"); plain != "https://aws.amazon.com" || expectation != (targetExpectation{}) {
+		t.Fatalf("a target without the placeholder became %q with %+v", plain, expectation)
+	}
+	if plain, expectation := prepareTarget("https://example.com/robots.txt#sha256=ABCD"); plain != "https://example.com/robots.txt" || expectation.sha256 != "abcd" {
+		t.Fatalf("a target with a hash became %q with %+v", plain, expectation)
+	}
+}
+
+func TestTimeTargetRequestChecksTheNonce(t *testing.T) {
+	judge := httptest.NewServer(NewJudgeServerHandler())
+	defer judge.Close()
+	target := judge.URL + TargetPath + "?nonce=" + NoncePlaceholder
+	// A proxy that answers every request with its own page, as a captive portal or a cache would.
+	fake := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		fmt.Fprintln(writer, "welcome to the free wifi")
+	}))
+	defer fake.Close()
+	tests := []struct {
+		name, proxy string
+		wantErr     bool
+	}{
+		{"honest proxy", "http://" + startHTTPProxyStub(t, false, true), false},
+		{"proxy serving its own page", fake.URL, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxyURL, _ := url.Parse(test.proxy)
+			client, transport := newProxyClient(context.Background(), proxyURL)
+			defer transport.CloseIdleConnections()
+			result, err := timeTargetRequest(context.Background(), client, target)
+			if (err != nil) != test.wantErr || IsTampering(err) != test.wantErr {
+				t.Fatalf("err = %v, want tampering: %v", err, test.wantErr)
+			}
+			if err == nil && result.Target != target {
+				t.Fatalf("target = %q, want the placeholder kept", result.Target)
+			}
+		})
+	}
+}
+
+func TestJudgeServesTheTargetOverTLS(t *testing.T) {
+	judge := httptest.NewTLSServer(NewJudgeServerHandler())
+	defer judge.Close()
+	proxy := "http://" + startHTTPProxyStub(t, false, true)
+	targets := []string{judge.URL + TargetPath + "?nonce=" + NoncePlaceholder}
+
+	checked, err := checkTargets(withRootCAs(context.Background(), serverRootCAs(judge)), proxy, targets)
+	if err != nil {
+		t.Fatalf("request through a CONNECT tunnel to the HTTPS judge failed: %v", err)
+	}
+	if len(checked) != 1 || !strings.HasPrefix(checked[0].Target, "https://") {
+		t.Fatalf("checked = %+v", checked)
+	}
+	// A judge certificate that is not trusted cannot be told from an intercepting proxy.
+	if _, err := checkTargets(context.Background(), proxy, targets); !IsTampering(err) {
+		t.Fatalf("err = %v, want tampering for an untrusted certificate", err)
+	}
+}
+
+func TestSelfSignedCertificate(t *testing.T) {
+	certificate, err := selfSignedCertificate([]string{"127.0.0.1", "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	judge := httptest.NewUnstartedServer(NewJudgeServerHandler())
+	judge.TLS = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	judge.StartTLS()
+	defer judge.Close()
+	parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(parsed)
+	targets := []string{judge.URL + TargetPath + "?nonce=" + NoncePlaceholder}
+	proxy := "http://" + startHTTPProxyStub(t, false, true)
+
+	// Once trusted, the certificate verifies for the address the judge is reached by, through an honest tunnel too.
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	response, err := client.Get(judge.URL + TargetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", response.StatusCode)
+	}
+	if _, err := checkTargets(withRootCAs(context.Background(), roots), proxy, targets); err != nil {
+		t.Fatalf("request through a CONNECT tunnel to the trusted judge failed: %v", err)
+	}
+}
+
+func TestJudgeCertificateHosts(t *testing.T) {
+	tests := []struct {
+		address string
+		hosts   []string
+		want    string
+	}{
+		{":8443", nil, "localhost,127.0.0.1,::1"},
+		{"0.0.0.0:8443", nil, "localhost,127.0.0.1,::1"},
+		{"judge.example.com:8443", nil, "judge.example.com"},
+		{"198.51.100.7:8443", nil, "198.51.100.7"},
+		{":8443", []string{"judge.example.com", "198.51.100.7"}, "judge.example.com,198.51.100.7"},
+	}
+	for _, test := range tests {
+		if got := strings.Join(judgeCertificateHosts(test.address, test.hosts), ","); got != test.want {
+			t.Errorf("judgeCertificateHosts(%q, %v) = %q, want %q", test.address, test.hosts, got, test.want)
+		}
+	}
+}
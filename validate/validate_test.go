@@ -0,0 +1,147 @@
+package validate
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/complexorganizations/proxy-registry/source"
+)
+
+func TestCheckFindsTheWorkingProtocol(t *testing.T) {
+	checker := newTestChecker(startTargetServer(t).URL)
+	// The stub waits for a SOCKS5 greeting, so the other validators would only run into their timeouts.
+	checker.Validators = []Validator{SOCKS5Validator{}}
+	proxy := startSOCKS5Stub(t, socks5Succeeded)
+
+	result, ok := checker.Check(context.Background(), source.Proxy{Address: proxy, Sources: []string{"test"}})
+	if !ok {
+		t.Fatal("expected the socks5 stub to pass")
+	}
+	if len(result.Protocols) != 1 || result.Protocols[0].URL != "socks5://"+proxy {
+		t.Fatalf("protocols = %+v, want socks5 only", result.Protocols)
+	}
+	if result.Anonymity != AnonymityUnknown || result.Capabilities != nil {
+		t.Fatalf("result = %+v, want unknown anonymity and no capabilities", result)
+	}
+}
+
+func TestCheckTriesTheHintedProtocolFirst(t *testing.T) {
+	checker := newTestChecker(startTargetServer(t).URL)
+	proxy := startHTTPProxyStub(t, false, true)
+
+	// Without the short-circuit the SOCKS validators would wait on the HTTP stub until they time out.
+	protocols := checker.Protocols(context.Background(), source.Proxy{Address: proxy, Protocol: "https"})
+	if len(protocols) != 1 || protocols[0].URL != "http://"+proxy {
+		t.Fatalf("protocols = %+v, want the hinted HTTP family only", protocols)
+	}
+	result, ok := checker.Check(context.Background(), source.Proxy{Address: proxy, Protocol: "http"})
+	if !ok || result.Capabilities == nil || !result.Capabilities.Connect {
+		t.Fatalf("result = %+v, want an HTTP proxy with CONNECT", result)
+	}
+}
+
+func TestCheckRejectsADeadProxy(t *testing.T) {
+	checker := newTestChecker(startTargetServer(t).URL)
+	if _, ok := checker.Check(context.Background(), source.Proxy{Address: "127.0.0.1:1"}); ok {
+		t.Fatal("expected a closed port to fail")
+	}
+}
+
+// Listen on the IPv6 loopback address, skipping the test on machines without one.
+func listenIPv6Loopback(t *testing.T) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	return listener
+}
+
+func TestCheckValidatesIPv6Proxies(t *testing.T) {
+	// The target listens on the IPv6 loopback too, so the CONNECT request carries an IPv6 destination.
+	target := httptest.NewUnstartedServer(startTargetServer(t).Config.Handler)
+	target.Listener = listenIPv6Loopback(t)
+	target.Start()
+	defer target.Close()
+	httpProxy := httptest.NewUnstartedServer(httpProxyStubHandler(true, nil))
+	httpProxy.Listener = listenIPv6Loopback(t)
+	httpProxy.Start()
+	defer httpProxy.Close()
+	tests := []struct {
+		name, proxy, protocol string
+	}{
+		{"http", strings.TrimPrefix(httpProxy.URL, "http://"), "http"},
+		{"socks5", serveSOCKS5Stub(t, listenIPv6Loopback(t), socks5Succeeded, nil), "socks5"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy, err := source.ParseProxy(test.protocol + "://" + test.proxy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, ok := newTestChecker(target.URL).Check(context.Background(), proxy)
+			if !ok {
+				t.Fatalf("expected the %s stub on %s to pass", test.protocol, test.proxy)
+			}
+			if result.Protocols[0].URL != test.protocol+"://"+test.proxy || result.Family != source.FamilyIPv6 {
+				t.Fatalf("result = %+v, want a bracketed IPv6 URL and the ipv6 family", result)
+			}
+		})
+	}
+}
+
+func TestCheckValidatesProxiesListedByHostname(t *testing.T) {
+	checker := newTestChecker(startTargetServer(t).URL)
+	checker.Validators = []Validator{SOCKS5Validator{}}
+	_, port, err := net.SplitHostPort(startSOCKS5Stub(t, socks5Succeeded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := source.Proxy{Address: "localhost:" + port, ResolvedIPs: []string{"127.0.0.1"}}
+
+	result, ok := checker.Check(context.Background(), proxy)
+	if !ok {
+		t.Fatal("expected the proxy listed by hostname to pass")
+	}
+	if result.Protocols[0].URL != "socks5://localhost:"+port || result.Family != source.FamilyIPv4 || len(result.ResolvedIPs) != 1 {
+		t.Fatalf("result = %+v, want the hostname URL, the ipv4 family and the resolved address", result)
+	}
+}
+
+func TestCheckConnectsToTheResolvedAddressOfProxiesListedByHostname(t *testing.T) {
+	target := startTargetServer(t)
+	tests := []struct {
+		name      string
+		validator Validator
+		proxy     string
+		scheme    string
+	}{
+		{"http", HTTPValidator{}, startHTTPProxyStub(t, false, true), "http"},
+		{"https", HTTPValidator{}, startHTTPProxyStub(t, true, true), "https"},
+		{"socks4", SOCKS4Validator{}, startSOCKS4Stub(t, socks4Granted).address(), "socks4"},
+		{"socks5", SOCKS5Validator{}, startSOCKS5Stub(t, socks5Succeeded), "socks5"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checker := newTestChecker(target.URL)
+			checker.Validators = []Validator{test.validator}
+			_, port, err := net.SplitHostPort(test.proxy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The .invalid name never resolves, so the check only passes through the pinned address.
+			proxy := source.Proxy{Address: "proxy.invalid:" + port, ResolvedIPs: []string{"127.0.0.1"}}
+
+			result, ok := checker.Check(context.Background(), proxy)
+			if !ok {
+				t.Fatalf("expected the %s proxy to be reached at its resolved address", test.name)
+			}
+			if result.Proxy != proxy.Address || result.Protocols[0].URL != test.scheme+"://proxy.invalid:"+port {
+				t.Fatalf("result = %+v, want the hostname kept for display", result)
+			}
+		})
+	}
+}